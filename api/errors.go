@@ -23,6 +23,8 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/http"
+
+	"github.com/pkg/errors"
 )
 
 // errorResponse handles errors caused by a Lacework API request
@@ -70,6 +72,17 @@ func (r *errorResponse) Error() string {
 	)
 }
 
+// ErrorStatusCode returns the HTTP status code of an error returned by
+// a request to the Lacework API, or zero if the error was not caused by
+// a response from the server, like a network error
+func ErrorStatusCode(err error) int {
+	var errRes *errorResponse
+	if errors.As(err, &errRes) && errRes.Response != nil {
+		return errRes.Response.StatusCode
+	}
+	return 0
+}
+
 // checkResponse checks the provided response and generates an Error
 func checkErrorInResponse(r *http.Response) error {
 	if c := r.StatusCode; c >= 200 && c <= 299 {
@@ -22,6 +22,7 @@ import (
 	"net/http"
 	"testing"
 
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
 
 	"github.com/lacework/go-sdk/api"
@@ -255,3 +256,26 @@ func TestErrorInvalidStatusCode(t *testing.T) {
 		)
 	}
 }
+
+func TestErrorStatusCode(t *testing.T) {
+	fakeServer := lacework.MockServer()
+	fakeServer.MockAPI(
+		"external/any/endpoint",
+		func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, `{"ok": false, "message": "Too Many Requests"}`, http.StatusTooManyRequests)
+		},
+	)
+	defer fakeServer.Close()
+
+	c, err := api.NewClient("test",
+		api.WithToken("TOKEN"),
+		api.WithURL(fakeServer.URL()),
+	)
+	assert.Nil(t, err)
+
+	err = c.RequestDecoder("GET", "external/any/endpoint", nil, nil)
+	assert.Equal(t, http.StatusTooManyRequests, api.ErrorStatusCode(err))
+	assert.Equal(t, http.StatusTooManyRequests, api.ErrorStatusCode(errors.Wrap(err, "wrapped")))
+	assert.Equal(t, 0, api.ErrorStatusCode(errors.New("network error")))
+	assert.Equal(t, 0, api.ErrorStatusCode(nil))
+}
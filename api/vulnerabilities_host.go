@@ -19,9 +19,15 @@
 package api
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"sort"
 	"strings"
 
+	"github.com/pkg/errors"
+
 	"github.com/lacework/go-sdk/lwtime"
 )
 
@@ -39,11 +45,28 @@ func (svc *HostVulnerabilityService) Scan(manifest *PackageManifest) (
 	response HostVulnScanPkgManifestResponse,
 	err error,
 ) {
-	err = svc.client.RequestEncoderDecoder("POST",
-		apiVulnerabilitiesScanPkgManifest,
-		manifest,
-		&response,
-	)
+	return svc.ScanWithContext(context.Background(), manifest)
+}
+
+// ScanWithContext is like Scan but the request is bound to the provided
+// context, cancelling the context aborts the request
+func (svc *HostVulnerabilityService) ScanWithContext(ctx context.Context,
+	manifest *PackageManifest,
+) (response HostVulnScanPkgManifestResponse, err error) {
+	body, err := jsonReader(manifest)
+	if err != nil {
+		return
+	}
+
+	request, err := svc.client.NewRequest("POST", apiVulnerabilitiesScanPkgManifest, body)
+	if err != nil {
+		return
+	}
+
+	res, err := svc.client.DoDecoder(request.WithContext(ctx), &response)
+	if res != nil {
+		defer res.Body.Close()
+	}
 
 	if err == nil {
 		// the API response coming from the Lacework server contains too much
@@ -500,6 +523,127 @@ type OsPkgInfo struct {
 	OsVer  string `json:"os_ver"`
 	Pkg    string `json:"pkg"`
 	PkgVer string `json:"pkg_ver"`
+
+	// the package manager that reported the package, it is only used
+	// locally and it is not sent to the assessment API
+	Source string `json:"-"`
+}
+
+// PkgSeparator separates the name and the version of a package in the strings
+// built by JoinPkg(), package managers don't allow it in package names, unlike
+// dashes that are common in both names and versions, like 'lib-foo-1.2-3'
+const PkgSeparator = "="
+
+// JoinPkg combines the name and the version of a package into a single string
+// that can be split back, unambiguously, via SplitPkg()
+func JoinPkg(name, version string) string {
+	return name + PkgSeparator + version
+}
+
+// SplitPkg splits a string built by JoinPkg() into the name and the version
+// of the package, it returns an error if the name or the version is missing
+func SplitPkg(s string) (name, version string, err error) {
+	idx := strings.Index(s, PkgSeparator)
+	if idx <= 0 || idx == len(s)-len(PkgSeparator) {
+		return "", "", errors.Errorf("invalid package '%s', expected name%sversion", s, PkgSeparator)
+	}
+	return s[:idx], s[idx+len(PkgSeparator):], nil
+}
+
+// Validate verifies that every package of the manifest has a name and a version,
+// and that all packages belong to the same operating system and version since
+// the assessment API expects the packages of a single host
+func (m *PackageManifest) Validate() error {
+	for i, pkg := range m.OsPkgInfoList {
+		if pkg.Pkg == "" || pkg.PkgVer == "" {
+			return errors.Errorf(
+				"invalid package at index %d, package name and version must be provided", i,
+			)
+		}
+	}
+
+	return m.ValidateSingleOS()
+}
+
+// ValidateSingleOS verifies that all packages of the manifest belong to the same
+// operating system and version, if they don't, it returns an error that reports
+// all the distinct operating systems and versions found in the manifest
+func (m *PackageManifest) ValidateSingleOS() error {
+	var (
+		distinct = []string{}
+		seen     = map[string]bool{}
+	)
+	for _, pkg := range m.OsPkgInfoList {
+		osVer := strings.TrimSpace(fmt.Sprintf("%s %s", pkg.Os, pkg.OsVer))
+		if !seen[osVer] {
+			seen[osVer] = true
+			distinct = append(distinct, osVer)
+		}
+	}
+
+	if len(distinct) > 1 {
+		sort.Strings(distinct)
+		return errors.Errorf(
+			"manifest contains packages from multiple operating systems: %s",
+			strings.Join(distinct, ", "),
+		)
+	}
+	return nil
+}
+
+// Sort orders the packages of the manifest in place by package name and
+// then by package version, this produces a deterministic output regardless
+// of the order in which the package manager reported them
+func (m *PackageManifest) Sort() {
+	sort.SliceStable(m.OsPkgInfoList, func(i, j int) bool {
+		a, b := m.OsPkgInfoList[i], m.OsPkgInfoList[j]
+		if a.Pkg != b.Pkg {
+			return a.Pkg < b.Pkg
+		}
+		return a.PkgVer < b.PkgVer
+	})
+}
+
+// Clone returns a deep copy of the manifest, modifying the packages of the
+// copy doesn't modify the packages of the original manifest
+func (m *PackageManifest) Clone() *PackageManifest {
+	if m == nil {
+		return nil
+	}
+
+	clone := new(PackageManifest)
+	if m.OsPkgInfoList != nil {
+		clone.OsPkgInfoList = make([]OsPkgInfo, len(m.OsPkgInfoList))
+		copy(clone.OsPkgInfoList, m.OsPkgInfoList)
+	}
+	return clone
+}
+
+// Redact returns a copy of the manifest where the name and version of the
+// packages that match the provided matcher are replaced by a short hash, the
+// hash is stable so redacted packages can still be correlated across logs
+//
+// The redacted manifest is meant for logs and debug output, the original
+// manifest is not modified and it is the one that must be submitted
+func (m *PackageManifest) Redact(matcher func(OsPkgInfo) bool) *PackageManifest {
+	redacted := m.Clone()
+	if redacted == nil {
+		return nil
+	}
+
+	for i, pkg := range redacted.OsPkgInfoList {
+		if matcher(pkg) {
+			redacted.OsPkgInfoList[i].Pkg = redactedValue(pkg.Pkg)
+			redacted.OsPkgInfoList[i].PkgVer = redactedValue(pkg.PkgVer)
+		}
+	}
+	return redacted
+}
+
+// redactedValue returns the first 12 characters of the SHA-256 of the value
+func redactedValue(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return "redacted-" + hex.EncodeToString(sum[:])[:12]
 }
 
 type HostScanPackageVulnFixInfo struct {
@@ -0,0 +1,149 @@
+//
+// Author:: Salim Afiune Maya (<afiune@lacework.net>)
+// Copyright:: Copyright 2021, Lacework Inc.
+// License:: Apache License, Version 2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package api
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// the package URL type of the packages for each operating system, the types
+// 'ebuild', 'opkg' and 'xbps' are proposed but not yet part of the spec
+//
+// See https://github.com/package-url/purl-spec
+var packageURLTypes = map[string]string{
+	"debian":    "deb",
+	"ubuntu":    "deb",
+	"alpine":    "apk",
+	"almalinux": "rpm",
+	"amzn":      "rpm",
+	"centos":    "rpm",
+	"fedora":    "rpm",
+	"ol":        "rpm",
+	"opensuse":  "rpm",
+	"rhel":      "rpm",
+	"rocky":     "rpm",
+	"sles":      "rpm",
+	"gentoo":    "ebuild",
+	"openwrt":   "opkg",
+	"void":      "xbps",
+}
+
+// packages installed via the nix package manager have this prefix
+const nixPackagePrefix = "nix:"
+
+// CycloneDXBOM is a minimal CycloneDX Software Bill of Materials
+//
+// See https://cyclonedx.org/docs/1.3/json/
+type CycloneDXBOM struct {
+	BomFormat   string               `json:"bomFormat"`
+	SpecVersion string               `json:"specVersion"`
+	Version     int                  `json:"version"`
+	Components  []CycloneDXComponent `json:"components"`
+}
+
+type CycloneDXComponent struct {
+	Type    string `json:"type"`
+	Name    string `json:"name"`
+	Version string `json:"version"`
+	Purl    string `json:"purl,omitempty"`
+}
+
+// PackageManifestToCycloneDX converts the provided package manifest into a
+// minimal CycloneDX Software Bill of Materials, every package is mapped to
+// a library component with its name, version and package URL (PURL)
+func PackageManifestToCycloneDX(manifest *PackageManifest) *CycloneDXBOM {
+	bom := &CycloneDXBOM{
+		BomFormat:   "CycloneDX",
+		SpecVersion: "1.3",
+		Version:     1,
+		Components:  []CycloneDXComponent{},
+	}
+
+	if manifest == nil {
+		return bom
+	}
+
+	for _, pkg := range manifest.OsPkgInfoList {
+		bom.Components = append(bom.Components, CycloneDXComponent{
+			Type:    "library",
+			Name:    pkg.Pkg,
+			Version: pkg.PkgVer,
+			Purl:    pkg.PURL(""),
+		})
+	}
+	return bom
+}
+
+// PURL returns the package URL of the package for the provided operating system,
+// if the operating system is empty, the one from the package is used. Packages
+// from operating systems without a known package URL type are 'generic' packages
+// and packages installed via nix are 'nix' packages, the architecture of dpkg
+// multiarch packages, like 'libc6:amd64', is added as a qualifier
+//
+// Example: pkg:deb/ubuntu/openssl@1.1.1f-1ubuntu2?arch=amd64&distro=ubuntu-20.04
+//
+// See https://github.com/package-url/purl-spec
+func (pkg OsPkgInfo) PURL(osName string) string {
+	if osName == "" {
+		osName = pkg.Os
+	}
+	osName = strings.ToLower(osName)
+
+	if strings.HasPrefix(pkg.Pkg, nixPackagePrefix) {
+		return fmt.Sprintf("pkg:nix/%s@%s",
+			url.PathEscape(strings.TrimPrefix(pkg.Pkg, nixPackagePrefix)), url.PathEscape(pkg.PkgVer),
+		)
+	}
+
+	purlType, ok := packageURLTypes[osName]
+	if !ok {
+		return fmt.Sprintf("pkg:generic/%s@%s", url.PathEscape(pkg.Pkg), url.PathEscape(pkg.PkgVer))
+	}
+
+	var (
+		name       = pkg.Pkg
+		version    = pkg.PkgVer
+		qualifiers = []string{}
+	)
+	// qualifiers must be sorted by key: arch, distro and epoch
+	if parts := strings.SplitN(name, ":", 2); purlType == "deb" && len(parts) == 2 {
+		name = parts[0]
+		qualifiers = append(qualifiers, "arch="+parts[1])
+	}
+
+	distro := "distro=" + osName
+	if pkg.OsVer != "" {
+		distro += "-" + pkg.OsVer
+	}
+	qualifiers = append(qualifiers, distro)
+
+	// the epoch of rpm packages is a qualifier, not part of the version
+	if epoch := strings.SplitN(version, ":", 2); purlType == "rpm" && len(epoch) == 2 {
+		version = epoch[1]
+		if epoch[0] != "0" {
+			qualifiers = append(qualifiers, "epoch="+epoch[0])
+		}
+	}
+
+	return fmt.Sprintf("pkg:%s/%s/%s@%s?%s",
+		purlType, osName, url.PathEscape(name), url.PathEscape(version), strings.Join(qualifiers, "&"),
+	)
+}
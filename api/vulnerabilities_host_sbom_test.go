@@ -0,0 +1,112 @@
+//
+// Author:: Salim Afiune Maya (<afiune@lacework.net>)
+// Copyright:: Copyright 2021, Lacework Inc.
+// License:: Apache License, Version 2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package api_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	subject "github.com/lacework/go-sdk/api"
+)
+
+func TestPackageManifestToCycloneDX(t *testing.T) {
+	manifest := &subject.PackageManifest{
+		OsPkgInfoList: []subject.OsPkgInfo{
+			subject.OsPkgInfo{Os: "ubuntu", OsVer: "18.04", Pkg: "openssl", PkgVer: "1.1.1-1ubuntu2.1~18.04.6"},
+			subject.OsPkgInfo{Os: "centos", OsVer: "7", Pkg: "openssl", PkgVer: "1:1.0.2k-19.el7"},
+			subject.OsPkgInfo{Os: "alpine", OsVer: "3.13.5", Pkg: "musl", PkgVer: "1.2.2-r0"},
+			subject.OsPkgInfo{Os: "plan9", OsVer: "4", Pkg: "bash", PkgVer: "5.1.008_1"},
+			subject.OsPkgInfo{Os: "rocky", OsVer: "8", Pkg: "bash", PkgVer: "0:4.4.20-4.el8_6"},
+			subject.OsPkgInfo{Os: "void", OsVer: "", Pkg: "bash", PkgVer: "5.1.008_1"},
+			subject.OsPkgInfo{Os: "ubuntu", OsVer: "18.04", Pkg: "nix:hello", PkgVer: "2.10"},
+		},
+	}
+
+	bom := subject.PackageManifestToCycloneDX(manifest)
+	assert.Equal(t, "CycloneDX", bom.BomFormat)
+	assert.Equal(t, "1.3", bom.SpecVersion)
+	assert.Equal(t, 1, bom.Version)
+	if assert.Len(t, bom.Components, 7) {
+		assert.Equal(t, subject.CycloneDXComponent{
+			Type:    "library",
+			Name:    "openssl",
+			Version: "1.1.1-1ubuntu2.1~18.04.6",
+			Purl:    "pkg:deb/ubuntu/openssl@1.1.1-1ubuntu2.1~18.04.6?distro=ubuntu-18.04",
+		}, bom.Components[0])
+		assert.Equal(t,
+			"pkg:rpm/centos/openssl@1.0.2k-19.el7?distro=centos-7&epoch=1",
+			bom.Components[1].Purl)
+		assert.Equal(t,
+			"pkg:apk/alpine/musl@1.2.2-r0?distro=alpine-3.13.5",
+			bom.Components[2].Purl)
+		assert.Equal(t, "pkg:generic/bash@5.1.008_1", bom.Components[3].Purl)
+		assert.Equal(t,
+			"pkg:rpm/rocky/bash@4.4.20-4.el8_6?distro=rocky-8",
+			bom.Components[4].Purl)
+		assert.Equal(t, "pkg:xbps/void/bash@5.1.008_1?distro=void", bom.Components[5].Purl)
+		assert.Equal(t, "pkg:nix/hello@2.10", bom.Components[6].Purl)
+	}
+
+	// the manifest is not modified
+	assert.Len(t, manifest.OsPkgInfoList, 7)
+
+	// empty manifests generate a valid document
+	bomJSON, err := json.Marshal(subject.PackageManifestToCycloneDX(nil))
+	assert.Nil(t, err)
+	assert.Equal(t,
+		`{"bomFormat":"CycloneDX","specVersion":"1.3","version":1,"components":[]}`,
+		string(bomJSON))
+}
+
+func TestOsPkgInfoPURL(t *testing.T) {
+	cases := []struct {
+		expected string
+		osName   string
+		pkg      subject.OsPkgInfo
+	}{
+		// dpkg
+		{expected: "pkg:deb/ubuntu/openssl@1.1.1f-1ubuntu2?distro=ubuntu-20.04",
+			pkg: subject.OsPkgInfo{Os: "ubuntu", OsVer: "20.04", Pkg: "openssl", PkgVer: "1.1.1f-1ubuntu2"}},
+		{expected: "pkg:deb/ubuntu/openssl@1.1.1f-1ubuntu2?arch=amd64&distro=ubuntu-20.04",
+			pkg: subject.OsPkgInfo{Os: "ubuntu", OsVer: "20.04", Pkg: "openssl:amd64", PkgVer: "1.1.1f-1ubuntu2"}},
+		{expected: "pkg:deb/debian/libc6@2.31-13?arch=i386&distro=debian-11",
+			osName: "Debian",
+			pkg:    subject.OsPkgInfo{Os: "linuxmint", OsVer: "11", Pkg: "libc6:i386", PkgVer: "2.31-13"}},
+		// rpm
+		{expected: "pkg:rpm/centos/openssl@1.0.2k-19.el7?distro=centos-7&epoch=1",
+			pkg: subject.OsPkgInfo{Os: "centos", OsVer: "7", Pkg: "openssl", PkgVer: "1:1.0.2k-19.el7"}},
+		{expected: "pkg:rpm/amzn/bash@4.2.46-34.amzn2?distro=amzn-2",
+			pkg: subject.OsPkgInfo{Os: "amzn", OsVer: "2", Pkg: "bash", PkgVer: "4.2.46-34.amzn2"}},
+		// apk
+		{expected: "pkg:apk/alpine/musl@1.2.2-r0?distro=alpine-3.13.5",
+			pkg: subject.OsPkgInfo{Os: "alpine", OsVer: "3.13.5", Pkg: "musl", PkgVer: "1.2.2-r0"}},
+		// nix and unknown operating systems
+		{expected: "pkg:nix/hello@2.10",
+			pkg: subject.OsPkgInfo{Os: "ubuntu", OsVer: "20.04", Pkg: "nix:hello", PkgVer: "2.10"}},
+		{expected: "pkg:generic/bash@5.1.008_1",
+			pkg: subject.OsPkgInfo{Os: "plan9", OsVer: "4", Pkg: "bash", PkgVer: "5.1.008_1"}},
+	}
+	for _, kase := range cases {
+		t.Run(kase.expected, func(t *testing.T) {
+			assert.Equal(t, kase.expected, kase.pkg.PURL(kase.osName))
+		})
+	}
+}
@@ -19,6 +19,7 @@
 package api_test
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -124,3 +125,145 @@ func TestHostVulnScanPkgManifestResponseVulnerabilityCounts(t *testing.T) {
 	assert.Equal(t, int32(9), assessmentCounts.Total, "wrong total vuln")
 	assert.Equal(t, int32(2), assessmentCounts.TotalFixable, "wrong total fixable vuln")
 }
+
+func TestPackageManifestSort(t *testing.T) {
+	manifest := subject.PackageManifest{
+		OsPkgInfoList: []subject.OsPkgInfo{
+			subject.OsPkgInfo{Os: "ubuntu", OsVer: "18.04", Pkg: "sudo", PkgVer: "1.8.21p2-3ubuntu1.2"},
+			subject.OsPkgInfo{Os: "ubuntu", OsVer: "18.04", Pkg: "openssl", PkgVer: "1.1.1-1ubuntu2.1~18.04.6"},
+			subject.OsPkgInfo{Os: "ubuntu", OsVer: "18.04", Pkg: "linux-image-5.3.0-1035-aws", PkgVer: "5.3.0-1035.37"},
+			subject.OsPkgInfo{Os: "ubuntu", OsVer: "18.04", Pkg: "openssl", PkgVer: "1.1.0g-2ubuntu4"},
+		},
+	}
+	manifest.Sort()
+	assert.Equal(t, subject.PackageManifest{
+		OsPkgInfoList: []subject.OsPkgInfo{
+			subject.OsPkgInfo{Os: "ubuntu", OsVer: "18.04", Pkg: "linux-image-5.3.0-1035-aws", PkgVer: "5.3.0-1035.37"},
+			subject.OsPkgInfo{Os: "ubuntu", OsVer: "18.04", Pkg: "openssl", PkgVer: "1.1.0g-2ubuntu4"},
+			subject.OsPkgInfo{Os: "ubuntu", OsVer: "18.04", Pkg: "openssl", PkgVer: "1.1.1-1ubuntu2.1~18.04.6"},
+			subject.OsPkgInfo{Os: "ubuntu", OsVer: "18.04", Pkg: "sudo", PkgVer: "1.8.21p2-3ubuntu1.2"},
+		},
+	}, manifest)
+
+	// sorting empty manifests is safe
+	empty := subject.PackageManifest{}
+	empty.Sort()
+	assert.Empty(t, empty.OsPkgInfoList)
+}
+
+func TestPackageManifestClone(t *testing.T) {
+	manifest := &subject.PackageManifest{
+		OsPkgInfoList: []subject.OsPkgInfo{
+			subject.OsPkgInfo{Os: "ubuntu", OsVer: "18.04", Pkg: "sudo", PkgVer: "1.8.21p2-3ubuntu1.2"},
+			subject.OsPkgInfo{Os: "ubuntu", OsVer: "18.04", Pkg: "openssl", PkgVer: "1.1.1-1ubuntu2.1~18.04.6"},
+		},
+	}
+
+	clone := manifest.Clone()
+	assert.Equal(t, manifest, clone)
+
+	// the clone is independent from the original manifest
+	clone.OsPkgInfoList[0].PkgVer = "1.8.21p2-3ubuntu1.4"
+	clone.OsPkgInfoList = append(clone.OsPkgInfoList,
+		subject.OsPkgInfo{Os: "ubuntu", OsVer: "18.04", Pkg: "bash", PkgVer: "4.4.18-2ubuntu1.2"})
+	clone.Sort()
+	assert.Equal(t, "sudo", manifest.OsPkgInfoList[0].Pkg)
+	assert.Equal(t, "1.8.21p2-3ubuntu1.2", manifest.OsPkgInfoList[0].PkgVer)
+	assert.Len(t, manifest.OsPkgInfoList, 2)
+
+	assert.Equal(t, new(subject.PackageManifest), new(subject.PackageManifest).Clone())
+	assert.Nil(t, (*subject.PackageManifest)(nil).Clone())
+}
+
+func TestPackageManifestRedact(t *testing.T) {
+	manifest := &subject.PackageManifest{
+		OsPkgInfoList: []subject.OsPkgInfo{
+			subject.OsPkgInfo{Os: "ubuntu", OsVer: "18.04", Pkg: "sudo", PkgVer: "1.8.21p2-3ubuntu1.2"},
+			subject.OsPkgInfo{Os: "ubuntu", OsVer: "18.04", Pkg: "acme-agent", PkgVer: "2.1.0-internal"},
+		},
+	}
+	internal := func(pkg subject.OsPkgInfo) bool { return strings.HasPrefix(pkg.Pkg, "acme-") }
+
+	redacted := manifest.Redact(internal)
+	if assert.Len(t, redacted.OsPkgInfoList, 2) {
+		assert.Equal(t, manifest.OsPkgInfoList[0], redacted.OsPkgInfoList[0])
+		assert.Equal(t, "ubuntu", redacted.OsPkgInfoList[1].Os)
+		assert.Regexp(t, `^redacted-[0-9a-f]{12}$`, redacted.OsPkgInfoList[1].Pkg)
+		assert.Regexp(t, `^redacted-[0-9a-f]{12}$`, redacted.OsPkgInfoList[1].PkgVer)
+		assert.NotContains(t, redacted.OsPkgInfoList[1].PkgVer, "internal")
+	}
+
+	// the hash is stable and the original manifest is not modified
+	assert.Equal(t, redacted, manifest.Redact(internal))
+	assert.Equal(t, "acme-agent", manifest.OsPkgInfoList[1].Pkg)
+	assert.Equal(t, "2.1.0-internal", manifest.OsPkgInfoList[1].PkgVer)
+
+	assert.Nil(t, (*subject.PackageManifest)(nil).Redact(internal))
+}
+
+func TestJoinAndSplitPkg(t *testing.T) {
+	cases := []struct {
+		name    string
+		version string
+	}{
+		{"sudo", "1.8.21p2-3ubuntu1.2"},
+		{"linux-image-5.4.0-1045-aws", "5.4.0-1045.47"},
+		{"python3-pkg-resources", "45.2.0-1ubuntu0.1"},
+		{"kernel-core", "0:4.18.0-348.el8"},
+		{"nix:hello", "2.12.1"},
+	}
+	for _, kase := range cases {
+		joined := subject.JoinPkg(kase.name, kase.version)
+		name, version, err := subject.SplitPkg(joined)
+		if assert.Nil(t, err, joined) {
+			assert.Equal(t, kase.name, name)
+			assert.Equal(t, kase.version, version)
+		}
+	}
+
+	for _, invalid := range []string{"", "sudo", "sudo-1.8.21", "=1.8.21", "sudo="} {
+		_, _, err := subject.SplitPkg(invalid)
+		assert.NotNil(t, err, invalid)
+	}
+}
+
+func TestPackageManifestValidate(t *testing.T) {
+	manifest := subject.PackageManifest{
+		OsPkgInfoList: []subject.OsPkgInfo{
+			subject.OsPkgInfo{Os: "ubuntu", OsVer: "18.04", Pkg: "sudo", PkgVer: "1.8.21p2-3ubuntu1.2"},
+			subject.OsPkgInfo{Os: "ubuntu", OsVer: "18.04", Pkg: "openssl", PkgVer: "1.1.1-1ubuntu2.1~18.04.6"},
+		},
+	}
+	assert.Nil(t, manifest.Validate())
+
+	// empty manifests are valid
+	assert.Nil(t, new(subject.PackageManifest).Validate())
+
+	manifest.OsPkgInfoList[1].PkgVer = ""
+	if err := manifest.Validate(); assert.NotNil(t, err) {
+		assert.Equal(t,
+			"invalid package at index 1, package name and version must be provided",
+			err.Error())
+	}
+}
+
+func TestPackageManifestValidateSingleOS(t *testing.T) {
+	mixed := subject.PackageManifest{
+		OsPkgInfoList: []subject.OsPkgInfo{
+			subject.OsPkgInfo{Os: "ubuntu", OsVer: "18.04", Pkg: "sudo", PkgVer: "1.8.21p2-3ubuntu1.2"},
+			subject.OsPkgInfo{Os: "centos", OsVer: "7", Pkg: "openssl", PkgVer: "1:1.0.2k-19.el7"},
+			subject.OsPkgInfo{Os: "ubuntu", OsVer: "20.04", Pkg: "bash", PkgVer: "5.0-6ubuntu1.1"},
+			subject.OsPkgInfo{Os: "centos", OsVer: "7", Pkg: "bash", PkgVer: "4.2.46-34.el7"},
+		},
+	}
+	err := mixed.ValidateSingleOS()
+	if assert.NotNil(t, err) {
+		assert.Equal(t,
+			"manifest contains packages from multiple operating systems: centos 7, ubuntu 18.04, ubuntu 20.04",
+			err.Error())
+	}
+	assert.Equal(t, err.Error(), mixed.Validate().Error())
+
+	single := subject.PackageManifest{OsPkgInfoList: mixed.OsPkgInfoList[1:2]}
+	assert.Nil(t, single.ValidateSingleOS())
+}
@@ -110,6 +110,9 @@ type Honeyvent struct {
 	TraceID  string `json:"trace.trace_id,omitempty"`
 	SpanID   string `json:"trace.span_id,omitempty"`
 	ParentID string `json:"trace.parent_id,omitempty"`
+
+	// protects the feature data since features could add fields concurrently
+	mu sync.Mutex
 }
 
 // InitHoneyvent initialize honeycomb library and main Honeyvent, such event
@@ -177,6 +180,9 @@ func (c *cliState) SendHoneyvent() {
 		"span_id", c.Event.SpanID,
 		"parent_id", c.Event.ParentID,
 	)
+	c.Event.mu.Lock()
+	defer c.Event.mu.Unlock()
+
 	honeyvent := libhoney.NewEvent()
 	_ = honeyvent.Add(c.Event)
 
@@ -200,7 +206,12 @@ func (c *cliState) SendHoneyvent() {
 	c.Event.FeatureData = nil
 }
 
+// AddFeatureField adds a new field to the feature data of the Honeyvent,
+// this function is safe to be called concurrently from multiple goroutines
 func (e *Honeyvent) AddFeatureField(key string, value interface{}) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
 	if e.FeatureData == nil {
 		e.FeatureData = map[string]interface{}{key: value}
 		return
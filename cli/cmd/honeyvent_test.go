@@ -19,8 +19,10 @@
 package cmd
 
 import (
+	"fmt"
 	"os"
 	"runtime"
+	"sync"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -133,3 +135,24 @@ func TestSendHoneyventAccountToLower(t *testing.T) {
 	// event struct should be resetted
 	assert.Equal(t, "all-lower-or-all-upper", cli.Event.Account)
 }
+
+// run with 'go test -race' to detect data races
+func TestHoneyventAddFeatureFieldConcurrently(t *testing.T) {
+	event := &Honeyvent{}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(n int) {
+			defer wg.Done()
+			event.AddFeatureField(fmt.Sprintf("key%d", n), n)
+		}(i)
+	}
+	wg.Wait()
+
+	if assert.IsType(t, map[string]interface{}{}, event.FeatureData) {
+		featureData := event.FeatureData.(map[string]interface{})
+		assert.Len(t, featureData, 50)
+		assert.Equal(t, 7, featureData["key7"])
+	}
+}
@@ -0,0 +1,75 @@
+//
+// Author:: Salim Afiune Maya (<afiune@lacework.net>)
+// Copyright:: Copyright 2021, Lacework Inc.
+// License:: Apache License, Version 2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package cmd
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// QueryPackageFiles returns the list of files owned by the provided package, this
+// is useful for file-based matching where only the path of a file is known
+func (c *cliState) QueryPackageFiles(name string) ([]string, error) {
+	if name == "" {
+		return nil, errors.New("package name must be provided")
+	}
+
+	// knowing the OS selects the package manager of the distro on mixed systems
+	cfg := new(packageManifestConfig)
+	if osInfo, err := c.getOSInfo(cfg); err == nil {
+		cfg.osInfo = osInfo
+	}
+
+	manager, err := c.detectPackageManager(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	var query []byte
+	switch manager {
+	case "rpm":
+		query, err = cfg.query(cfg.command("rpm", "-ql", name))
+	case "dpkg-query":
+		query, err = cfg.query(cfg.command("dpkg", "-L", name))
+	default:
+		return nil, errors.Errorf("querying package files is not supported for '%s'", manager)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	c.Log.Debugw("package files query", "package", name, "raw", string(query))
+	return parsePackageFiles(query), nil
+}
+
+// parsePackageFiles parses the output of the commands 'rpm -ql' and 'dpkg -L'
+// into a list of files, we only keep absolute paths since these commands could
+// return messages like '(contains no files)' or 'diverted by ... to: ...'
+func parsePackageFiles(query []byte) []string {
+	files := []string{}
+	for _, line := range strings.Split(string(query), "\n") {
+		file := strings.TrimSpace(line)
+		if !strings.HasPrefix(file, "/") || file == "/." {
+			continue
+		}
+		files = append(files, file)
+	}
+	return files
+}
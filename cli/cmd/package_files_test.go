@@ -0,0 +1,58 @@
+//
+// Author:: Salim Afiune Maya (<afiune@lacework.net>)
+// Copyright:: Copyright 2021, Lacework Inc.
+// License:: Apache License, Version 2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package cmd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParsePackageFilesDpkg(t *testing.T) {
+	subject := parsePackageFiles([]byte(`/.
+/usr
+/usr/bin
+/usr/bin/sudo
+/usr/share/doc/sudo/copyright
+diverted by foo to: /usr/bin/sudo.real
+`))
+	assert.Equal(t, []string{
+		"/usr",
+		"/usr/bin",
+		"/usr/bin/sudo",
+		"/usr/share/doc/sudo/copyright",
+	}, subject)
+}
+
+func TestParsePackageFilesRpm(t *testing.T) {
+	subject := parsePackageFiles([]byte(`/etc/pki/tls/openssl.cnf
+/usr/bin/openssl
+`))
+	assert.Equal(t, []string{"/etc/pki/tls/openssl.cnf", "/usr/bin/openssl"}, subject)
+
+	assert.Empty(t, parsePackageFiles([]byte("(contains no files)\n")))
+	assert.Empty(t, parsePackageFiles([]byte("")))
+}
+
+func TestQueryPackageFilesEmptyName(t *testing.T) {
+	_, err := cli.QueryPackageFiles("")
+	if assert.NotNil(t, err) {
+		assert.Equal(t, "package name must be provided", err.Error())
+	}
+}
@@ -20,47 +20,384 @@ package cmd
 
 import (
 	"bufio"
+	"context"
+	"encoding/json"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
 	"os"
 	"os/exec"
+	"path"
+	"path/filepath"
 	"regexp"
 	"runtime"
+	"sort"
+	"strconv"
 	"strings"
 	"syscall"
 	"time"
+	"unicode"
 
 	"github.com/pkg/errors"
 
 	"github.com/lacework/go-sdk/api"
+	"github.com/lacework/go-sdk/internal/array"
 )
 
-var SupportedPackageManagers = []string{"dpkg-query", "rpm"} // @afiune can we support yum and apk?
+var SupportedPackageManagers = []string{"dpkg-query", "rpm", "yum", "xbps-query", "opkg", "portage", "pacman"} // @afiune can we support apk?
 
 type OS struct {
-	Name    string
-	Version string
+	Name    string `json:"name"`
+	Version string `json:"version"`
+
+	// the machine hardware name, like x86_64 or aarch64
+	Arch string `json:"arch,omitempty"`
+
+	// the init system, like systemd or openrc, empty when it is unknown
+	InitSystem string `json:"init_system,omitempty"`
+}
+
+// String returns the operating system in the form 'ubuntu 22.04 (x86_64)'
+func (o OS) String() string {
+	str := o.Name
+	if o.Version != "" {
+		str = fmt.Sprintf("%s %s", str, o.Version)
+	}
+	if o.Arch != "" {
+		str = fmt.Sprintf("%s (%s)", str, o.Arch)
+	}
+	return str
+}
+
+// AssessmentPackage is a package in the format expected by the assessment API
+type AssessmentPackage = api.OsPkgInfo
+
+// ToAssessmentFormat returns the provided package of the provided operating system
+// in the format expected by the assessment API, every package of the manifests we
+// generate goes through it, the operating system must be already normalized, like
+// the ones returned by GetOSInfo(), this function only defines the final shape:
+//
+//   - the operating system is the lowercase ID of the os-release file, like
+//     ubuntu, rhel, amzn, sles or alpine, after the mapping of the OSMapper
+//   - the operating system version is the VERSION_ID of the os-release file,
+//     like 22.04 or 8.6, or RollingReleaseVersion for rolling release distros
+//   - the package name and version are the ones from the package manager, as
+//     is, rpm versions have an epoch, like 0:1.2-3, and nix packages a prefix
+func ToAssessmentFormat(osInfo OS, pkg api.OsPkgInfo) AssessmentPackage {
+	return AssessmentPackage{
+		Os:     strings.ToLower(strings.TrimSpace(osInfo.Name)),
+		OsVer:  strings.TrimSpace(osInfo.Version),
+		Pkg:    strings.TrimSpace(pkg.Pkg),
+		PkgVer: strings.TrimSpace(pkg.PkgVer),
+		Source: pkg.Source,
+	}
+}
+
+// ErrNoSupportedPackageManager is returned when generating a package manifest
+// with the WithNonFatalMissingPackageManager() option and none of the supported
+// package managers are found on the host, callers can use it to skip the host
+var ErrNoSupportedPackageManager = errors.New("no supported package manager found")
+
+// ErrEndOfLifeOS is returned when generating a package manifest with the
+// WithEndOfLifeCheck(true) option and the detected operating system is listed
+// as end-of-life in the EndOfLifeOperatingSystems table
+var ErrEndOfLifeOS = errors.New("end-of-life operating system")
+
+// EndOfLifeOperatingSystems is a table of operating systems and their versions
+// that have reached their end-of-life, a version matches the detected version
+// exactly or as its major version, e.g. '6' matches both '6' and '6.10'
+var EndOfLifeOperatingSystems = map[string][]string{
+	"centos": []string{"5", "6", "8"},
+	"debian": []string{"6", "7", "8"},
+	"ubuntu": []string{"12.04", "14.04", "16.04", "19.10", "20.10"},
+	"fedora": []string{"31", "32", "33"},
+	"alpine": []string{"3.10", "3.11"},
+}
+
+// ImmutableOperatingSystems are operating systems shipped as an immutable image
+// where packages are not separately managed, for these systems, the package
+// manifest contains a single package that represents the image version
+var ImmutableOperatingSystems = []string{"flatcar", "coreos"}
+
+// RollingReleaseOperatingSystems are operating systems without versioned releases,
+// their os-release file doesn't have a VERSION_ID or it has a snapshot date, for
+// these systems, the version of the operating system is RollingReleaseVersion
+var RollingReleaseOperatingSystems = []string{
+	"arch", "manjaro", "endeavouros", "gentoo", "void", "opensuse-tumbleweed",
+}
+
+// RollingReleaseVersion is the version of the RollingReleaseOperatingSystems
+const RollingReleaseVersion = "rolling"
+
+// KernelVersionFormat is the format that the active kernel must have to suppress
+// inactive kernel packages, when the detected active kernel doesn't match it,
+// like an empty string or a custom kernel string of a container host, the
+// suppression is skipped to avoid removing every installed kernel
+var KernelVersionFormat = regexp.MustCompile(`^\d+\.\d+(\.\d+)*([-.+_~][0-9A-Za-z._+~-]*)?$`)
+
+// PackageManifestStats are statistics about the generation of a package manifest,
+// use the WithManifestStats() option to collect them
+type PackageManifestStats struct {
+	// the package manager used to query the installed packages
+	PackageManager string
+
+	// the total number of packages in the generated manifest
+	TotalPackages int
+
+	// the number of packages excluded by the WithPackageFilter() option
+	FilteredPackages int
+
+	// the number of packages excluded by the WithArchitecture() option
+	ArchExcludedPackages int
+
+	// the number of times a query was retried because the package database was locked
+	PackageDBLockRetries int
+
+	// the number of packages added by every package manager, only set
+	// when the WithAllPackageManagers() option is provided
+	PackagesByManager map[string]int
+
+	// the last time the package database was modified, it is
+	// zero when the database of the package manager is unknown
+	PackageDBModTime time.Time
+
+	// the package database didn't change since the baseline was
+	// generated, therefore, the baseline manifest was returned
+	Unchanged bool
+
+	// the time spent in every phase of the generation of the manifest,
+	// detecting the package manager, querying it, parsing its output and
+	// suppressing inactive kernel packages
+	DetectionDuration   time.Duration
+	QueryDuration       time.Duration
+	ParseDuration       time.Duration
+	SuppressionDuration time.Duration
+
+	// the major version of the active kernel is below the minimum version
+	// of the WithMinimumKernelMajorVersion() option
+	KernelBelowMinimum bool
+
+	// the warnings found while generating the manifest, like skipped packages
+	// or suppressed kernels, so that callers can surface them without logs
+	Warnings []ManifestWarning
+}
+
+// ManifestWarning is a non-fatal issue found while generating a package manifest
+type ManifestWarning struct {
+	Code    string                 `json:"code"`
+	Message string                 `json:"message"`
+	Context map[string]interface{} `json:"context,omitempty"`
 }
 
+// The codes of the warnings of the generation of package manifests
+const (
+	ManifestWarningEndOfLifeOS             = "end_of_life_os"
+	ManifestWarningKernelBelowMinimum      = "kernel_below_minimum"
+	ManifestWarningNoPackageManager        = "no_package_manager"
+	ManifestWarningMultiplePackageManagers = "multiple_package_managers"
+	ManifestWarningUnparsablePackage       = "unparsable_package"
+	ManifestWarningKernelSuppressed        = "kernel_suppressed"
+	ManifestWarningQueryFailed             = "query_failed"
+	ManifestWarningChrootFallback          = "chroot_fallback"
+)
+
+// addWarning records a warning in the manifest stats
+func (cfg *packageManifestConfig) addWarning(code, message string, context map[string]interface{}) {
+	if cfg.stats == nil {
+		return
+	}
+	cfg.stats.Warnings = append(cfg.stats.Warnings, ManifestWarning{
+		Code:    code,
+		Message: message,
+		Context: context,
+	})
+}
+
+// OSReleasePathEnv is an environment variable that can be used to override
+// the path of the os-release file used to detect the operating system, when
+// set, it takes precedence over any other os-release or system-release file
+//
+// The path is a file of the local host, therefore, it is ignored when the
+// package manifest is generated for a process via the WithTargetPID() option
+const OSReleasePathEnv = "LW_OS_RELEASE_PATH"
+
 var (
 	osReleaseFile  = "/etc/os-release"
 	sysReleaseFile = "/etc/system-release"
-	rexNameFromID  = regexp.MustCompile(`^ID=(.*)$`)
-	rexVersionID   = regexp.MustCompile(`^VERSION_ID=(.*)$`)
+
+	// the os-release file provided by the vendor, systemd reads it when
+	// the /etc/os-release file doesn't exist, like on immutable images
+	vendorOSReleaseFile = "/usr/lib/os-release"
+
+	// classic release files of older or minimal systems without os-release
+	redhatReleaseFile = "/etc/redhat-release"
+	debianVersionFile = "/etc/debian_version"
+	rexRedhatRelease  = regexp.MustCompile(`^(.+?)\s+release\s+(\d+)`)
+	rexDebianVersion  = regexp.MustCompile(`^(\d+)`)
+
+	// the distros from the redhat-release file mapped to their os-release ID
+	redhatReleaseDistros = map[string]string{
+		"centos":     "centos",
+		"red hat":    "rhel",
+		"fedora":     "fedora",
+		"oracle":     "ol",
+		"rocky":      "rocky",
+		"almalinux":  "almalinux",
+		"scientific": "scientific",
+	}
+	rexNameFromID = regexp.MustCompile(`^ID=(.*)$`)
+	rexName       = regexp.MustCompile(`^NAME=(.*)$`)
+	rexVersionID  = regexp.MustCompile(`^VERSION_ID=(.*)$`)
+
+	// the NixOS system profile, all its requisites are the installed packages
+	nixCurrentSystem = "/run/current-system"
+
+	// the kernel command line, it contains the kernel image that was booted
+	procCmdline = "/proc/cmdline"
+
+	// the kernel version of the host, used to detect WSL
+	procVersion       = "/proc/version"
+	procKernelRelease = "/proc/sys/kernel/osrelease"
+
+	// the portage database (vardb) of Gentoo, every installed package is a
+	// directory with the name '{category}/{name}-{version}'
+	portageVardb = "/var/db/pkg"
+	// the version of a portage package, it could have a letter, suffixes
+	// like '_rc1' or '_p20230101' and a revision like '-r2'
+	rexPortageAtom = regexp.MustCompile(
+		`^(.+?)-(\d+(?:\.\d+)*[a-z]?(?:_(?:alpha|beta|pre|rc|p)\d*)*(?:-r\d+)?)$`,
+	)
+
+	// the architectures of Go mapped to the machine hardware name that the Linux
+	// kernel reports via 'uname -m', architectures without a single machine name,
+	// like '386' (i386, i586, i686) or 'arm' (armv6l, armv7l), are not mapped
+	goarchMachines = map[string]string{
+		"amd64":   "x86_64",
+		"arm64":   "aarch64",
+		"ppc64le": "ppc64le",
+		"s390x":   "s390x",
+		"riscv64": "riscv64",
+	}
+
+	// the files and directories that identify every init system, in the order
+	// they are probed, since some files like /etc/inittab are not exclusive
+	initSystemProbes = []struct {
+		name string
+		path string
+	}{
+		{"systemd", "/run/systemd/system"},
+		{"openrc", "/run/openrc"},
+		{"openrc", "/sbin/openrc"},
+		{"sysvinit", "/etc/inittab"},
+	}
+
+	// the architecture and flavor suffixes of kernel versions from 'uname -r'
+	rexKernelArchSuffix   = regexp.MustCompile(`\.(x86_64|aarch64|ppc64le|s390x|i686|noarch)$`)
+	rexKernelFlavorSuffix = regexp.MustCompile(`-[a-z][a-z0-9_+]*$`)
+
+	// the revision of apk package versions, like the 'r7' of 'musl-1.2.2-r7'
+	rexApkRevision = regexp.MustCompile(`^r\d+$`)
+
+	// rpm kernel packages, SUSE names them after the flavor of the kernel,
+	// like kernel-default, instead of the kernel name of other distros
+	rpmKernelPackages = []string{
+		"kernel",
+		"kernel-default", "kernel-default-base",
+		"kernel-azure", "kernel-preempt", "kernel-64kb",
+	}
+
+	// pacman kernel packages, Arch names them after the kernel variant
+	rexPacmanKernelPackage = regexp.MustCompile(`^linux(-lts|-zen|-hardened|-rt|-rt-lts)?$`)
+
+	// the version and patch level of Arch kernels, like 6.5.7.arch1-1
+	rexPacmanKernelPatchLevel = regexp.MustCompile(`^(\d+\.\d+(?:\.\d+)?)\.([a-z]+\d+-\d+)$`)
+
+	// dpkg kernel packages, like linux-image-5.4.0-1045-aws, with the kernel version
+	rexDpkgKernelPackage = regexp.MustCompile(`^linux-image-(?:unsigned-)?(\d.*)$`)
+
+	// the package manager of every distro, from the ID of the os-release file
+	distroPackageManagers = map[string]string{
+		"debian":      "dpkg-query",
+		"ubuntu":      "dpkg-query",
+		"amzn":        "rpm",
+		"centos":      "rpm",
+		"fedora":      "rpm",
+		"ol":          "rpm",
+		"rhel":        "rpm",
+		"rocky":       "rpm",
+		"sles":        "rpm",
+		"sled":        "rpm",
+		"opensuse":    "rpm",
+		"alpine":      "apk",
+		"void":        "xbps-query",
+		"openwrt":     "opkg",
+		"gentoo":      "portage",
+		"arch":        "pacman",
+		"manjaro":     "pacman",
+		"endeavouros": "pacman",
+	}
+
+	// the distros and versions where yum is preferred over rpm, their hosts
+	// are scanned with the same view of yum, a version matches the detected
+	// version exactly or as its major version, like EndOfLifeOperatingSystems
+	yumDistroVersions = map[string][]string{
+		"rhel":   []string{"5", "6"},
+		"centos": []string{"5", "6"},
+		"ol":     []string{"5", "6"},
+		"amzn":   []string{"2016.09", "2017.03", "2017.09", "2018.03"},
+	}
+
+	// the files of the database of every package manager, they are modified
+	// every time a package is installed, upgraded or removed
+	packageDBFiles = map[string][]string{
+		"rpm":        []string{"/var/lib/rpm/Packages", "/var/lib/rpm/rpmdb.sqlite"},
+		"yum":        []string{"/var/lib/rpm/Packages"},
+		"dpkg-query": []string{"/var/lib/dpkg/status"},
+		"apk":        []string{"/lib/apk/db/installed"},
+		"xbps-query": []string{"/var/db/xbps/pkgdb-0.38.plist"},
+		"opkg":       []string{"/usr/lib/opkg/status"},
+		// every installed package is a directory inside its category
+		"portage": []string{"/var/db/pkg/*"},
+		// every installed package is a directory with its metadata
+		"pacman": []string{"/var/lib/pacman/local/*"},
+	}
 )
 
-func (c *cliState) GeneratePackageManifest() (*api.PackageManifest, error) {
+// GeneratePackageManifest generates the package manifest of the local host, it is
+// a wrapper of GeneratePackageManifestWithContext() with a background context
+func (c *cliState) GeneratePackageManifest(opts ...PackageManifestOption) (*api.PackageManifest, error) {
+	return c.GeneratePackageManifestWithContext(context.Background(), opts...)
+}
+
+// GeneratePackageManifestWithContext generates the package manifest of the local
+// host, every command we execute, like package managers, which, uname or nsenter,
+// is bound to the provided context, when it is cancelled or its deadline exceeds,
+// the running command is killed and the returned error names it
+func (c *cliState) GeneratePackageManifestWithContext(
+	ctx context.Context, opts ...PackageManifestOption,
+) (*api.PackageManifest, error) {
 	var (
 		err   error
 		start = time.Now()
+		cfg   = &packageManifestConfig{ctx: ctx}
 	)
 
+	for _, opt := range opts {
+		opt.apply(cfg)
+	}
+	if cfg.stats == nil {
+		cfg.stats = new(PackageManifestStats)
+	}
+
 	defer func() {
 		c.Event.DurationMs = time.Since(start).Milliseconds()
-		if err == nil {
-			// if this function returns an error, most likely,
-			// the command will send a honeyvent with that error,
-			// therefore we should duplicate events and only send
-			// one here if there is NO error
+		// if this function returns an error, most likely,
+		// the command will send a honeyvent with that error,
+		// therefore we should duplicate events and only send
+		// one here if there is NO error, or if the error is
+		// the non-fatal missing package manager
+		if err == nil || errors.Is(err, ErrNoSupportedPackageManager) {
 			c.SendHoneyvent()
 		}
 	}()
@@ -68,72 +405,310 @@ func (c *cliState) GeneratePackageManifest() (*api.PackageManifest, error) {
 	c.Event.Feature = featGenPkgManifest
 
 	manifest := new(api.PackageManifest)
-	osInfo, err := c.GetOSInfo()
+	if cfg.targetPID != 0 {
+		c.Event.AddFeatureField("target_pid", true)
+		if err = checkNsenter(cfg.context(), cfg.targetPID); err != nil {
+			return manifest, err
+		}
+	}
+
+	if cfg.chroot {
+		c.Event.AddFeatureField("chroot", true)
+		if err := checkChroot(cfg.context(), cfg.root); err != nil {
+			c.Log.Warnw("unable to chroot, reading the package databases of the root filesystem",
+				"root", cfg.root,
+				"error", err,
+			)
+			cfg.addWarning(ManifestWarningChrootFallback,
+				"unable to chroot, reading the package databases of the root filesystem",
+				map[string]interface{}{"root": cfg.root, "error": err.Error()},
+			)
+			c.Event.AddFeatureField("chroot_fallback", true)
+			cfg.chroot = false
+		}
+	}
+
+	osInfo, err := c.getOSInfo(cfg)
 	if err != nil {
 		return manifest, err
 	}
+	cfg.osInfo = osInfo
+	c.Log.Infow("operating system detected", "os", osInfo.String())
 	c.Event.AddFeatureField("os", osInfo.Name)
 	c.Event.AddFeatureField("os_ver", osInfo.Version)
+	c.Event.AddFeatureField("os_arch", osInfo.Arch)
+	if osInfo.InitSystem != "" {
+		c.Event.AddFeatureField("init_system", osInfo.InitSystem)
+	}
+	if osInfo.Version == RollingReleaseVersion {
+		c.Event.AddFeatureField("os_rolling", true)
+	}
 
-	manager, err := c.DetectPackageManager()
+	if cfg.endOfLifeCheck && isEndOfLifeOS(osInfo) {
+		c.Event.AddFeatureField("os_eol", true)
+		if cfg.failOnEndOfLife {
+			err = errors.Wrapf(ErrEndOfLifeOS, "%s %s", osInfo.Name, osInfo.Version)
+			return manifest, err
+		}
+		c.Log.Warnw("end-of-life operating system detected, vulnerability data might be stale",
+			"os", osInfo.Name, "os_ver", osInfo.Version,
+		)
+		cfg.addWarning(ManifestWarningEndOfLifeOS,
+			"end-of-life operating system detected, vulnerability data might be stale",
+			map[string]interface{}{"os": osInfo.Name, "os_ver": osInfo.Version},
+		)
+	}
+
+	// the kernel of the local host, from 'uname -r', is not the kernel of a root
+	// filesystem, like a mounted image, processes do share the kernel of the host
+	hostKernel := !cfg.foreignRoot() || cfg.targetPID != 0
+	if !hostKernel {
+		c.Log.Infow("root filesystem of another system, skipping kernel suppression", "root", cfg.root)
+		c.Event.AddFeatureField("root_filesystem", true)
+		cfg.skipKernelSuppression = true
+	}
+
+	if cfg.minimumKernelMajor > 0 && hostKernel {
+		c.checkMinimumKernelVersion(cfg)
+	}
+
+	// WSL hosts run a kernel provided by Windows that never matches any of the
+	// installed kernel packages of the distro, all of them would be suppressed
+	if hostKernel && c.isWSL() {
+		c.Log.Infow("WSL detected, skipping kernel suppression")
+		c.Event.AddFeatureField("wsl", true)
+		cfg.skipKernelSuppression = true
+	}
+
+	if isImmutableOS(osInfo) {
+		c.Log.Infow("immutable operating system detected, using image version as package",
+			"os", osInfo.Name, "os_ver", osInfo.Version,
+		)
+		c.Event.AddFeatureField("pkg_manager", "image")
+		cfg.stats.PackageManager = "image"
+		cfg.stats.TotalPackages = 1
+		manifest.OsPkgInfoList = append(manifest.OsPkgInfoList,
+			ToAssessmentFormat(*osInfo, api.OsPkgInfo{Pkg: osInfo.Name, PkgVer: osInfo.Version}),
+		)
+		return manifest, nil
+	}
+
+	detectionStart := time.Now()
+	manager, err := c.detectPackageManager(cfg)
+	if err != nil && cfg.nixPackages && c.checkPackageManager(cfg, "nix-store") {
+		// hosts like NixOS only have the nix package manager
+		c.Log.Infow("no supported package manager found, using only nix packages")
+		manager, err = "nix", nil
+	}
+	cfg.stats.DetectionDuration = time.Since(detectionStart)
+	c.Event.AddFeatureField("detection_ms", cfg.stats.DetectionDuration.Milliseconds())
+	if err != nil && ctx.Err() != nil {
+		// the package managers were not found because their checks were killed
+		err = errors.Wrap(ctx.Err(), "package manager detection cancelled (cmd: which)")
+		return manifest, err
+	}
 	if err != nil {
+		if cfg.nonFatalMissingManager {
+			c.Log.Warnw("no supported package manager found, returning empty manifest",
+				"error", err,
+			)
+			cfg.addWarning(ManifestWarningNoPackageManager,
+				"no supported package manager found, returning empty manifest",
+				map[string]interface{}{"error": err.Error()},
+			)
+			c.Event.AddFeatureField("pkg_manager", "none")
+			err = ErrNoSupportedPackageManager
+		}
 		return manifest, err
 	}
 	c.Event.AddFeatureField("pkg_manager", manager)
+	cfg.stats.PackageManager = manager
+
+	dbModTime, dbFound := c.packageDBModTime(cfg, manager)
+	cfg.stats.PackageDBModTime = dbModTime
+	if cfg.baseline != nil {
+		switch {
+		case !dbFound:
+			c.Log.Infow("unknown package database, ignoring baseline", "package-manager", manager)
+		case cfg.nixPackages:
+			// nix packages are not tracked by the database of the package manager
+			c.Log.Infow("nix packages enabled, ignoring baseline")
+		case cfg.allPackageManagers:
+			// only the database of the first package manager is checked
+			c.Log.Infow("all package managers enabled, ignoring baseline")
+		case !dbModTime.After(cfg.baselineTime):
+			c.Log.Infow("package database didn't change since baseline, skipping query",
+				"db_mod_time", dbModTime,
+				"baseline_time", cfg.baselineTime,
+			)
+			c.Event.AddFeatureField("baseline_unchanged", true)
+			cfg.stats.Unchanged = true
+			// the active kernel could have changed after a reboot, the baseline
+			// goes through the same suppression as any generated manifest
+			return c.finalizePackageManifest(cfg, cfg.baseline.Clone(), manager), nil
+		}
+	}
+
+	managers := []string{manager}
+	if cfg.allPackageManagers {
+		for _, detected := range c.detectedPackageManagers(cfg) {
+			if detected != manager {
+				managers = append(managers, detected)
+			}
+		}
+		c.Event.AddFeatureField("pkg_managers", strings.Join(managers, ","))
+	}
+	if cfg.nixPackages && manager != "nix" {
+		managers = append(managers, "nix")
+	}
+
+	var (
+		queryDuration time.Duration
+		parseDuration time.Duration
+		seen          = map[api.OsPkgInfo]bool{}
+	)
+	for i, source := range managers {
+		queryStart := time.Now()
+		managerQuery, err := c.queryPackages(cfg, source)
+		queryDuration += time.Since(queryStart)
+		if err != nil {
+			if i == 0 && source != "nix" {
+				return manifest, err
+			}
+			// additional package managers never fail the generation of the manifest
+			c.Log.Warnw("unable to query packages, skipping",
+				"package-manager", source,
+				"error", err,
+			)
+			cfg.addWarning(ManifestWarningQueryFailed,
+				"unable to query packages, skipping",
+				map[string]interface{}{"package_manager": source, "error": err.Error()},
+			)
+			continue
+		}
+		c.Log.Debugw("package-manager query", "package-manager", source, "raw", string(managerQuery))
+
+		parseStart := time.Now()
+		count := 0
+		for _, pkg := range c.parsePackageQuery(cfg, managerQuery) {
+			// packages reported by multiple package managers are added only once
+			if i > 0 && seen[pkg] {
+				continue
+			}
+			seen[pkg] = true
+			if cfg.allPackageManagers {
+				pkg.Source = source
+			}
+			manifest.OsPkgInfoList = append(manifest.OsPkgInfoList, pkg)
+			count++
+		}
+		parseDuration += time.Since(parseStart)
+
+		if cfg.allPackageManagers {
+			if cfg.stats.PackagesByManager == nil {
+				cfg.stats.PackagesByManager = map[string]int{}
+			}
+			cfg.stats.PackagesByManager[source] = count
+			c.Event.AddFeatureField(fmt.Sprintf("pkgs_%s", source), count)
+		}
+	}
+
+	cfg.stats.QueryDuration = queryDuration
+	c.Event.AddFeatureField("query_ms", cfg.stats.QueryDuration.Milliseconds())
+	cfg.stats.ParseDuration = parseDuration
+	c.Event.AddFeatureField("parse_ms", cfg.stats.ParseDuration.Milliseconds())
+	if cfg.architecture != "" {
+		c.Event.AddFeatureField("arch_excluded_pkgs", cfg.stats.ArchExcludedPackages)
+	}
+	c.Event.AddFeatureField("total_manifest_pkgs", len(manifest.OsPkgInfoList))
+	c.Log.Debugw("package-manifest", "raw", manifest)
+	return c.finalizePackageManifest(cfg, manifest, manager), nil
+}
 
-	var managerQuery []byte
+// queryPackages queries the installed packages of the provided package manager,
+// the output has one package per line in the form {PkgName},{PkgVersion} or,
+// for package managers that know the architecture, {PkgName},{PkgVersion},{PkgArch}
+func (c *cliState) queryPackages(cfg *packageManifestConfig, manager string) ([]byte, error) {
+	var (
+		err          error
+		managerQuery []byte
+	)
 	switch manager {
 	case "rpm":
-		managerQuery, err = exec.Command(
-			"rpm", "-qa", "--queryformat", "%{NAME},%|EPOCH?{%{EPOCH}}:{0}|:%{VERSION}-%{RELEASE}\n",
-		).Output()
+		managerQuery, err = cfg.query(cfg.command(
+			"rpm", "-qa", "--queryformat", "%{NAME},%|EPOCH?{%{EPOCH}}:{0}|:%{VERSION}-%{RELEASE},%{ARCH}\n",
+		))
 		if err != nil {
-			return manifest, errors.Wrap(err, "unable to query packages from package manager")
+			return managerQuery, err
 		}
 	case "dpkg-query":
-		managerQuery, err = exec.Command(
-			"dpkg-query", "--show", "--showformat", "${Package},${Version}\n",
-		).Output()
+		var dpkgQuery []byte
+		dpkgQuery, err = cfg.query(cfg.command(
+			"dpkg-query", "--show", "--showformat", "${Package},${Version},${Architecture},${db:Status-Abbrev}\n",
+		))
 		if err != nil {
-			return manifest, errors.Wrap(err, "unable to query packages from package manager")
+			return managerQuery, err
 		}
+		managerQuery = formatDpkgQuery(dpkgQuery)
 	case "yum":
-		return manifest, errors.New("yum not yet supported")
+		var yumList []byte
+		yumList, err = cfg.query(cfg.command("yum", "--quiet", "--cacheonly", "list", "installed"))
+		if err != nil {
+			return managerQuery, err
+		}
+		managerQuery = formatYumQuery(yumList)
 	case "apk":
-		apkInfo, err := exec.Command("apk", "info").Output()
+		var apkInfoWithVersion []byte
+		apkInfoWithVersion, err = cfg.query(cfg.command("apk", "info", "-v"))
 		if err != nil {
-			return manifest, errors.Wrap(err, "unable to query packages from package manager")
+			return managerQuery, err
 		}
-		apkInfoT := strings.TrimSuffix(string(apkInfo), "\n")
-		apkInfoArray := strings.Split(apkInfoT, "\n")
-
-		apkInfoWithVersion, err := exec.Command("apk", "info", "-v").Output()
+		managerQuery = formatApkQuery(apkInfoWithVersion)
+	case "xbps-query":
+		var xbpsQuery []byte
+		xbpsQuery, err = cfg.query(cfg.command("xbps-query", "-l"))
 		if err != nil {
-			return manifest, errors.Wrap(err, "unable to query packages from package manager")
-		}
-		apkInfoWithVersionT := strings.TrimSuffix(string(apkInfoWithVersion), "\n")
-		apkInfoWithVersionArray := strings.Split(apkInfoWithVersionT, "\n")
-
-		mq := []string{}
-		for i, pkg := range apkInfoWithVersionArray {
-			mq = append(mq,
-				fmt.Sprintf("%s,%s",
-					apkInfoArray[i],
-					strings.Trim(
-						strings.Replace(pkg, apkInfoArray[i], "", 1),
-						"-",
-					),
-				),
-			)
+			return managerQuery, err
+		}
+		managerQuery = formatXbpsQuery(xbpsQuery)
+	case "opkg":
+		var opkgQuery []byte
+		opkgQuery, err = cfg.query(cfg.command("opkg", "list-installed"))
+		if err != nil {
+			return managerQuery, err
+		}
+		managerQuery = formatOpkgQuery(opkgQuery)
+	case "pacman":
+		var pacmanQuery []byte
+		pacmanQuery, err = cfg.query(cfg.command("pacman", "-Q"))
+		if err != nil {
+			return managerQuery, err
+		}
+		managerQuery = formatPacmanQuery(pacmanQuery)
+	case "portage":
+		managerQuery, err = queryPortageVardb(cfg)
+		if err != nil {
+			return managerQuery, err
+		}
+	case "nix":
+		managerQuery, err = c.queryNixPackages(cfg)
+		if err != nil {
+			return managerQuery, err
 		}
-		managerQuery = []byte(strings.Join(mq, "\n"))
 	default:
-		return manifest, errors.New(
+		return managerQuery, errors.New(
 			"this is most likely a mistake on us, please report it to support@lacework.com.",
 		)
 	}
 
-	c.Log.Debugw("package-manager query", "raw", string(managerQuery))
+	return managerQuery, nil
+}
+
+// parsePackageQuery parses the output of queryPackages() into packages of the
+// detected operating system, skipping lines that can't be parsed and packages
+// excluded by the WithArchitecture() option
+func (c *cliState) parsePackageQuery(cfg *packageManifestConfig, managerQuery []byte) []api.OsPkgInfo {
+	var pkgs []api.OsPkgInfo
 
 	// @afiune this is an example of the output from the query we
 	// send to the local package-manager:
@@ -142,116 +717,1181 @@ func (c *cliState) GeneratePackageManifest() (*api.PackageManifest, error) {
 	// ...
 	// {PkgName},{PkgVersion}\n
 	//
+	// package managers that know the architecture of packages, like rpm and
+	// dpkg, add it as a third element: {PkgName},{PkgVersion},{PkgArch}
+	//
 	// first, trim the last carriage return
 	managerQueryOut := strings.TrimSuffix(string(managerQuery), "\n")
 	// then, split by carriage return
 	for _, pkg := range strings.Split(managerQueryOut, "\n") {
+		if pkg == "" {
+			continue
+		}
+
 		// finally, split by comma to get PackageName and PackageVersion
 		pkgDetail := strings.Split(pkg, ",")
 
-		// the splitted package detail must be size of 2 elements
-		if len(pkgDetail) != 2 {
-			c.Log.Warnw("unable to parse package, expected length=2, skipping",
-				"raw_pkg_details", pkg,
-				"split_pkg_details", pkgDetail,
-			)
-			continue
-		}
+		// the splitted package detail must be size of 2 or 3 elements
+		if len(pkgDetail) != 2 && len(pkgDetail) != 3 {
+			c.Log.Warnw("unable to parse package, expected length=2, skipping",
+				"raw_pkg_details", pkg,
+				"split_pkg_details", pkgDetail,
+			)
+			cfg.addWarning(ManifestWarningUnparsablePackage,
+				"unable to parse package, skipping",
+				map[string]interface{}{"raw_pkg_details": pkg},
+			)
+			continue
+		}
+
+		if len(pkgDetail) == 3 && !cfg.includesArch(pkgDetail[2]) {
+			cfg.stats.ArchExcludedPackages++
+			continue
+		}
+
+		pkgs = append(pkgs,
+			ToAssessmentFormat(*cfg.osInfo, api.OsPkgInfo{Pkg: pkgDetail[0], PkgVer: pkgDetail[1]}),
+		)
+	}
+	return pkgs
+}
+
+// finalizePackageManifest applies the filter of the WithPackageFilter() option,
+// removes the inactive kernel packages, unless the WithoutKernelSuppression()
+// option is provided, and, if configured, the packages installed before the time
+// of the WithInstalledSince() option
+func (c *cliState) finalizePackageManifest(
+	cfg *packageManifestConfig, manifest *api.PackageManifest, manager string,
+) *api.PackageManifest {
+	if cfg.packageFilter != nil {
+		manifest = c.filterPackages(cfg, manifest)
+	}
+	if cfg.skipKernelSuppression {
+		c.Log.Infow("kernel suppression disabled, keeping all kernel packages")
+		c.Event.AddFeatureField("kernel_suppression", false)
+	} else {
+		suppressionStart := time.Now()
+		var removed []api.OsPkgInfo
+		manifest, _, removed = c.removeInactivePackages(cfg.context(), manifest, manager)
+		for _, pkg := range removed {
+			cfg.addWarning(ManifestWarningKernelSuppressed,
+				"inactive kernel package removed from the manifest",
+				map[string]interface{}{"pkg_name": pkg.Pkg, "pkg_version": pkg.PkgVer},
+			)
+		}
+		cfg.stats.SuppressionDuration = time.Since(suppressionStart)
+		c.Event.AddFeatureField("suppression_ms", cfg.stats.SuppressionDuration.Milliseconds())
+	}
+	if !cfg.installedSince.IsZero() {
+		manifest = c.removePackagesInstalledBefore(cfg, manifest, manager, cfg.installedSince)
+	}
+	cfg.stats.TotalPackages = len(manifest.OsPkgInfoList)
+	return manifest
+}
+
+// filterPackages removes the packages rejected by the filter of the
+// WithPackageFilter() option and counts them in the manifest stats
+func (c *cliState) filterPackages(cfg *packageManifestConfig, manifest *api.PackageManifest) *api.PackageManifest {
+	newManifest := new(api.PackageManifest)
+	for _, pkg := range manifest.OsPkgInfoList {
+		if !cfg.packageFilter(pkg) {
+			cfg.stats.FilteredPackages++
+			continue
+		}
+		newManifest.OsPkgInfoList = append(newManifest.OsPkgInfoList, pkg)
+	}
+	c.Event.AddFeatureField("filtered_pkgs", cfg.stats.FilteredPackages)
+	return newManifest
+}
+
+// PackageDBModTime returns the last time the database of the package manager
+// of the local host was modified, callers can use it to decide if a cached
+// package manifest is still valid without generating a new one
+func (c *cliState) PackageDBModTime() (time.Time, error) {
+	manager, err := c.DetectPackageManager()
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	modTime, found := c.packageDBModTime(new(packageManifestConfig), manager)
+	if !found {
+		return modTime, errors.Errorf("unable to find the package database of %s", manager)
+	}
+	return modTime, nil
+}
+
+// packageDBModTime returns the last time the database of the provided package
+// manager was modified, if the database has multiple files, it returns the most
+// recent modification time, returns false if the database files are not found
+func (c *cliState) packageDBModTime(cfg *packageManifestConfig, manager string) (time.Time, bool) {
+	var (
+		modTime time.Time
+		found   bool
+	)
+	for _, file := range packageDBFiles[manager] {
+		// files could be patterns, like the category directories of portage
+		matches, _ := filepath.Glob(cfg.path(file))
+		for _, match := range matches {
+			info, err := os.Stat(match)
+			if err != nil {
+				continue
+			}
+			found = true
+			if info.ModTime().After(modTime) {
+				modTime = info.ModTime()
+			}
+		}
+	}
+
+	if !found {
+		c.Log.Debugw("unable to find package database", "package-manager", manager)
+	}
+	return modTime, found
+}
+
+// packageInstallTimes returns the last time every package was installed or
+// upgraded, returns false if the package manager doesn't track install times
+func (c *cliState) packageInstallTimes(cfg *packageManifestConfig, manager string) (map[string]time.Time, bool) {
+	installTimes := map[string]time.Time{}
+
+	switch manager {
+	case "rpm", "yum":
+		query, err := cfg.query(cfg.command("rpm", "-qa", "--queryformat", "%{NAME},%{INSTALLTIME}\n"))
+		if err != nil {
+			c.Log.Warnw("unable to query install time of packages", "error", err)
+			return installTimes, false
+		}
+		for _, line := range strings.Split(string(query), "\n") {
+			pkgDetail := strings.Split(line, ",")
+			if len(pkgDetail) != 2 {
+				continue
+			}
+			epoch, err := strconv.ParseInt(pkgDetail[1], 10, 64)
+			if err != nil {
+				continue
+			}
+			// multiple versions of a package can be installed, like the kernel
+			installTime := time.Unix(epoch, 0)
+			if installTime.After(installTimes[pkgDetail[0]]) {
+				installTimes[pkgDetail[0]] = installTime
+			}
+		}
+	case "dpkg-query":
+		// dpkg doesn't track install times, the list of files of every package
+		// is written every time the package is installed or upgraded
+		lists, err := filepath.Glob(cfg.path("/var/lib/dpkg/info/*.list"))
+		if err != nil || len(lists) == 0 {
+			c.Log.Warnw("unable to find package lists of dpkg", "error", err)
+			return installTimes, false
+		}
+		for _, list := range lists {
+			info, err := os.Stat(list)
+			if err != nil {
+				continue
+			}
+			// multi-arch packages have the architecture in the name, 'libc6:amd64.list'
+			name := strings.SplitN(strings.TrimSuffix(filepath.Base(list), ".list"), ":", 2)[0]
+			installTimes[name] = info.ModTime()
+		}
+	default:
+		return installTimes, false
+	}
+
+	return installTimes, true
+}
+
+// removePackagesInstalledBefore removes the packages that were installed before
+// the provided time, packages without an install time are kept in the manifest
+func (c *cliState) removePackagesInstalledBefore(
+	cfg *packageManifestConfig, manifest *api.PackageManifest, manager string, since time.Time,
+) *api.PackageManifest {
+	installTimes, tracked := c.packageInstallTimes(cfg, manager)
+	if !tracked {
+		c.Log.Warnw("install time of packages not available, including all packages",
+			"package-manager", manager,
+			"since", since,
+		)
+		return manifest
+	}
+
+	var (
+		newManifest = new(api.PackageManifest)
+		unknown     = 0
+	)
+	for _, pkg := range manifest.OsPkgInfoList {
+		installTime, found := installTimes[pkg.Pkg]
+		if !found {
+			unknown++
+		} else if !installTime.After(since) {
+			continue
+		}
+		newManifest.OsPkgInfoList = append(newManifest.OsPkgInfoList, pkg)
+	}
+
+	if unknown != 0 {
+		c.Log.Warnw("install time of some packages not available, including them",
+			"total_unknown", unknown,
+			"since", since,
+		)
+	}
+	c.Event.AddFeatureField("installed_since_pkgs", len(newManifest.OsPkgInfoList))
+	return newManifest
+}
+
+// the maximum number of characters from the stderr of a package
+// manager command that we include in the errors we return
+const pkgManagerStderrMaxLen = 512
+
+// queryPackageManager executes the provided package manager command and returns
+// its output, when the command fails, we include a snippet of its stderr in the
+// returned error since it usually contains the actual reason of the failure
+func queryPackageManager(cmd *exec.Cmd) ([]byte, error) {
+	out, err := cmd.Output()
+	if err != nil {
+		return out, wrapPackageManagerError(err)
+	}
+	return out, nil
+}
+
+var (
+	// the number of times a package manager query that failed because the
+	// package database is locked is retried, unless WithPackageDBLockRetries()
+	packageDBLockRetries = 3
+
+	// the time to wait before retrying a query of a locked package database,
+	// this delay is multiplied by the attempt number to back off
+	packageDBLockRetryDelay = time.Second
+
+	// the errors of rpm and dpkg when another process holds the lock of their
+	// database, other errors, like a corrupted database, are never retried
+	rexPackageDBLockError = regexp.MustCompile(
+		`(?i)(database is locked|cannot get (shared|exclusive) lock|` +
+			`status database area is locked|could not get lock|dpkg frontend lock)`,
+	)
+)
+
+// isPackageDBLockError returns true if the provided error of a package manager
+// command was caused by another process holding the lock of the package database
+func isPackageDBLockError(err error) bool {
+	exitError, ok := err.(*exec.ExitError)
+	if !ok {
+		return false
+	}
+	return rexPackageDBLockError.Match(exitError.Stderr)
+}
+
+func wrapPackageManagerError(err error) error {
+	msg := "unable to query packages from package manager"
+
+	if exitError, ok := err.(*exec.ExitError); ok {
+		stderr := strings.TrimSpace(string(exitError.Stderr))
+		if len(stderr) > pkgManagerStderrMaxLen {
+			stderr = stderr[:pkgManagerStderrMaxLen] + "..."
+		}
+		if stderr != "" {
+			return errors.Wrapf(err, "%s (stderr: %s)", msg, stderr)
+		}
+	}
+
+	return errors.Wrap(err, msg)
+}
+
+// formatApkQuery converts the output of the command 'apk info -v' (package names
+// with versions) into the format '{PkgName},{PkgVersion}' we use to parse package
+// manager queries, the version is made of the last two '-' separated segments,
+// the version and its '-rN' revision, like '1.2.2-r7', when a version doesn't
+// end with a revision, the version starts after the first '-' followed by a digit
+//
+// The names from 'apk info' are not used, its output is not guaranteed to have
+// the same order nor the same length as the output of 'apk info -v'
+//
+// Example of the output from 'apk info -v':
+//
+// musl-1.2.2-r7
+// py3-foo-0.1.0_git20220101-r0
+func formatApkQuery(apkInfoWithVersion []byte) []byte {
+	mq := []string{}
+	for _, pkg := range strings.Split(string(apkInfoWithVersion), "\n") {
+		if name, version, ok := splitApkPackage(strings.TrimSpace(pkg)); ok {
+			mq = append(mq, fmt.Sprintf("%s,%s", name, version))
+		}
+	}
+	return []byte(strings.Join(mq, "\n"))
+}
+
+// splitApkPackage splits a package from 'apk info -v' into its name and version
+func splitApkPackage(pkg string) (string, string, bool) {
+	segments := strings.Split(pkg, "-")
+	if n := len(segments); n >= 3 && rexApkRevision.MatchString(segments[n-1]) {
+		return strings.Join(segments[:n-2], "-"), strings.Join(segments[n-2:], "-"), true
+	}
+
+	for i := 1; i < len(pkg)-1; i++ {
+		if pkg[i] == '-' && unicode.IsDigit(rune(pkg[i+1])) {
+			return pkg[:i], pkg[i+1:], true
+		}
+	}
+	return "", "", false
+}
+
+// formatYumQuery converts the output of the command 'yum list installed' into the
+// format '{PkgName},{PkgVersion},{PkgArch}' we use to parse package manager queries,
+// the version has an epoch, like the versions of rpm, even if yum doesn't show it
+//
+// Lines are wrapped when the package name is too long, we read the output as a
+// sequence of 'name.arch [epoch:]version-release repository' fields instead
+//
+// Example of the output from 'yum list installed':
+//
+//	Installed Packages
+//	bash.x86_64                          4.1.2-48.el6              @base
+//	java-1.8.0-openjdk-headless.x86_64
+//	                                     1:1.8.0.275.b01-0.el6     @updates
+func formatYumQuery(yumList []byte) []byte {
+	var (
+		mq     = []string{}
+		fields []string
+		header = strings.Contains(string(yumList), "Installed Packages")
+	)
+	for _, line := range strings.Split(string(yumList), "\n") {
+		if !header {
+			fields = append(fields, strings.Fields(line)...)
+		} else if strings.HasPrefix(line, "Installed Packages") {
+			// everything before the header, like loaded plugins, is not a package
+			header = false
+		}
+
+		for len(fields) >= 3 {
+			nameArch, version := fields[0], fields[1]
+			fields = fields[3:]
+
+			idx := strings.LastIndex(nameArch, ".")
+			if idx <= 0 {
+				continue
+			}
+			epoch := "0"
+			if i := strings.Index(version, ":"); i != -1 {
+				epoch = version[:i]
+			}
+			mq = append(mq, fmt.Sprintf("%s,%s:%s,%s",
+				nameArch[:idx], epoch, removeEpochFromPkgVersion(version), nameArch[idx+1:]))
+		}
+	}
+	return []byte(strings.Join(mq, "\n"))
+}
+
+// formatDpkgQuery converts the output of the command 'dpkg-query --show' with the
+// format '${Package},${Version},${Architecture},${db:Status-Abbrev}' into the format
+// '{PkgName},{PkgVersion},{PkgArch}' we use to parse package manager queries,
+// packages that are not installed, like removed packages with their configuration
+// files left (rc), are excluded
+//
+// Example of the output from 'dpkg-query --show':
+//
+// sudo,1.8.31-1ubuntu1.2,amd64,ii
+// vim,2:8.1.2269-1ubuntu5,amd64,hi
+// nano,4.8-1ubuntu1,amd64,rc
+func formatDpkgQuery(dpkgQuery []byte) []byte {
+	mq := []string{}
+	for _, line := range strings.Split(string(dpkgQuery), "\n") {
+		fields := strings.SplitN(strings.TrimSpace(line), ",", 4)
+		if len(fields) != 4 {
+			continue
+		}
+
+		if !isDpkgInstalledAbbrev(fields[3]) {
+			continue
+		}
+		name, arch := splitDpkgArch(fields[0], fields[2])
+		mq = append(mq, fmt.Sprintf("%s,%s,%s", name, fields[1], arch))
+	}
+	return []byte(strings.Join(mq, "\n"))
+}
+
+// isDpkgInstalled returns true if the provided dpkg status, like 'install ok installed',
+// is from an installed package, the status is 'want flag status', only the last one
+// tells us if the package is installed, packages on hold are installed too
+func isDpkgInstalled(status string) bool {
+	fields := strings.Fields(status)
+	return len(fields) == 3 && fields[2] == "installed"
+}
+
+// isDpkgInstalledAbbrev returns true if the provided abbreviated dpkg status, like
+// 'ii', is from an installed package, the abbreviation is the first letter of the
+// 'want flag status' of isDpkgInstalled(), only installed packages (ii) and packages
+// on hold (hi) are kept, the error flag, if any, is ignored
+func isDpkgInstalledAbbrev(abbrev string) bool {
+	abbrev = strings.TrimSpace(abbrev)
+	if len(abbrev) < 2 {
+		return false
+	}
+	return abbrev[:2] == "ii" || abbrev[:2] == "hi"
+}
+
+// formatDpkgStatus converts the paragraphs of a dpkg status file, like
+// /var/lib/dpkg/status, into the format '{PkgName},{PkgVersion},{PkgArch}'
+// we use to parse package manager queries, packages that are not installed
+// are excluded like in formatDpkgQuery
+//
+// Example of a paragraph from a dpkg status file:
+//
+//	Package: sudo
+//	Status: install ok installed
+//	Priority: optional
+//	Architecture: amd64
+//	Version: 1.8.31-1ubuntu1.2
+//	Description: Provide limited super user privileges to specific users
+//	 Sudo is a program designed to allow a sysadmin to give limited root
+func formatDpkgStatus(r io.Reader) ([]byte, error) {
+	var (
+		mq        = []string{}
+		paragraph = map[string]string{}
+		scanner   = bufio.NewScanner(r)
+	)
+	// fields like Conffiles or Description can have long lines
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	flush := func() {
+		if paragraph["Package"] != "" && isDpkgInstalled(paragraph["Status"]) {
+			name, arch := splitDpkgArch(paragraph["Package"], paragraph["Architecture"])
+			mq = append(mq, fmt.Sprintf("%s,%s,%s", name, paragraph["Version"], arch))
+		}
+		paragraph = map[string]string{}
+	}
+
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.TrimSpace(line) == "":
+			flush()
+		case line[0] == ' ' || line[0] == '\t':
+			// continuation of a multi-line field, like Description
+			continue
+		default:
+			if idx := strings.Index(line, ":"); idx > 0 {
+				paragraph[line[:idx]] = strings.TrimSpace(line[idx+1:])
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	flush()
+	return []byte(strings.Join(mq, "\n")), nil
+}
+
+// splitDpkgArch splits the architecture qualifier of multiarch package names,
+// like libc6:amd64, from the package name, the vulnerability backend matches
+// bare package names, the qualifier is returned as the architecture unless
+// the provided one is not empty
+func splitDpkgArch(name, arch string) (string, string) {
+	idx := strings.LastIndex(name, ":")
+	if idx <= 0 {
+		return name, arch
+	}
+	if arch == "" {
+		arch = name[idx+1:]
+	}
+	return name[:idx], arch
+}
+
+// formatXbpsQuery converts the output of the command 'xbps-query -l' into the
+// format '{PkgName},{PkgVersion}' we use to parse package manager queries
+//
+// Example of the output from 'xbps-query -l':
+//
+// ii bash-5.1.008_1           GNU Bourne Again Shell
+// ii xbps-triggers-0.119_1    XBPS triggers for Void Linux
+func formatXbpsQuery(xbpsQuery []byte) []byte {
+	mq := []string{}
+	for _, line := range strings.Split(string(xbpsQuery), "\n") {
+		fields := strings.Fields(line)
+
+		// only packages with the state 'ii' are fully installed
+		if len(fields) < 2 || fields[0] != "ii" {
+			continue
+		}
+
+		// the package version is always after the last dash, package
+		// names could have dashes but versions can't
+		idx := strings.LastIndex(fields[1], "-")
+		if idx <= 0 {
+			continue
+		}
+		mq = append(mq, fmt.Sprintf("%s,%s", fields[1][:idx], fields[1][idx+1:]))
+	}
+	return []byte(strings.Join(mq, "\n"))
+}
+
+// formatOpkgQuery converts the output of the command 'opkg list-installed' into
+// the format '{PkgName},{PkgVersion}' we use to parse package manager queries
+//
+// Example of the output from 'opkg list-installed':
+//
+// base-files - 1423-r16886-ef8a9c5e6d
+// libc - 1.1.24-4
+func formatOpkgQuery(opkgQuery []byte) []byte {
+	mq := []string{}
+	for _, line := range strings.Split(string(opkgQuery), "\n") {
+		pkgDetail := strings.SplitN(strings.TrimSpace(line), " - ", 2)
+		if len(pkgDetail) != 2 {
+			continue
+		}
+		mq = append(mq, fmt.Sprintf("%s,%s", pkgDetail[0], pkgDetail[1]))
+	}
+	return []byte(strings.Join(mq, "\n"))
+}
+
+// formatPacmanQuery converts the output of the command 'pacman -Q' into the
+// format '{PkgName},{PkgVersion}' we use to parse package manager queries
+//
+// Example of the output from 'pacman -Q':
+//
+// bash 5.1.016-1
+// linux 6.5.7.arch1-1
+func formatPacmanQuery(pacmanQuery []byte) []byte {
+	mq := []string{}
+	for _, line := range strings.Split(string(pacmanQuery), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		mq = append(mq, fmt.Sprintf("%s,%s", fields[0], fields[1]))
+	}
+	return []byte(strings.Join(mq, "\n"))
+}
+
+// queryNixPackages enumerates the packages installed via the nix package manager,
+// on NixOS we use the requisites of the current system, on any other system we
+// use the packages installed in the user environment
+func (c *cliState) queryNixPackages(cfg *packageManifestConfig) ([]byte, error) {
+	if !c.checkPackageManager(cfg, "nix-store") {
+		c.Log.Debugw("nix package manager not found, skipping nix packages")
+		return nil, nil
+	}
+
+	var (
+		nixQuery []byte
+		err      error
+	)
+	if _, statErr := os.Stat(cfg.path(nixCurrentSystem)); statErr == nil {
+		nixQuery, err = cfg.query(
+			cfg.command("nix-store", "-q", "--requisites", nixCurrentSystem),
+		)
+	} else {
+		nixQuery, err = cfg.query(cfg.command("nix-env", "-q"))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return formatNixQuery(nixQuery), nil
+}
+
+// formatNixQuery converts the output of 'nix-store -q --requisites' (store paths)
+// or 'nix-env -q' (derivation names) into the format '{PkgName},{PkgVersion}'
+// we use to parse package manager queries, package names are prefixed with 'nix:'
+//
+// Example of the output from 'nix-store -q --requisites /run/current-system':
+//
+// /nix/store/0c4j8wfmx8rvfpyz5lbkkg7l7p8rcfnm-openssl-1.1.1k
+// /nix/store/1jyjd0dm5l4j8rcbd5jhdg1w4wdqzy6x-etc
+func formatNixQuery(nixQuery []byte) []byte {
+	var (
+		mq   = []string{}
+		seen = map[string]bool{}
+	)
+	for _, line := range strings.Split(string(nixQuery), "\n") {
+		drv := strings.TrimSpace(line)
+		if strings.HasPrefix(drv, "/nix/store/") {
+			// remove the store directory and the hash from the path
+			drv = strings.TrimPrefix(drv, "/nix/store/")
+			if idx := strings.Index(drv, "-"); idx != -1 {
+				drv = drv[idx+1:]
+			}
+		}
+
+		name, version := parseNixDrvName(drv)
+		if name == "" || version == "" {
+			// store paths like configuration files don't have versions
+			continue
+		}
+
+		pkg := fmt.Sprintf("nix:%s,%s", name, version)
+		if !seen[pkg] {
+			seen[pkg] = true
+			mq = append(mq, pkg)
+		}
+	}
+	return []byte(strings.Join(mq, "\n"))
+}
+
+// parseNixDrvName splits a nix derivation name into its name and version, just
+// like nix does, the name ends at the first dash that is not followed by a letter
+func parseNixDrvName(drv string) (string, string) {
+	for i := 0; i < len(drv)-1; i++ {
+		if drv[i] == '-' && !unicode.IsLetter(rune(drv[i+1])) {
+			return drv[:i], drv[i+1:]
+		}
+	}
+	return drv, ""
+}
+
+// queryPortageVardb enumerates the packages installed via portage, the package
+// manager of Gentoo, by reading the directories of its database (vardb)
+func queryPortageVardb(cfg *packageManifestConfig) ([]byte, error) {
+	pkgDirs, err := filepath.Glob(filepath.Join(cfg.path(portageVardb), "*", "*"))
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to read portage database")
+	}
+
+	atoms := []string{}
+	for _, pkgDir := range pkgDirs {
+		var (
+			pkg      = filepath.Base(pkgDir)
+			category = filepath.Base(filepath.Dir(pkgDir))
+		)
+		// packages that are being merged are temporarily stored with this prefix
+		if strings.HasPrefix(pkg, "-MERGING-") {
+			continue
+		}
+		atoms = append(atoms, fmt.Sprintf("%s/%s", category, pkg))
+	}
+	return formatPortageQuery([]byte(strings.Join(atoms, "\n"))), nil
+}
+
+// formatPortageQuery converts a list of portage atoms, the directories of its
+// database or the output of the command 'qlist -Iv', into the format
+// '{PkgName},{PkgVersion}' we use to parse package manager queries
+//
+// Example of the output from 'qlist -IvS':
+//
+// dev-lang/python-3.11.8_p1:3.11
+// sys-libs/ncurses-6.4_p20230401-r1:0/6
+func formatPortageQuery(portageQuery []byte) []byte {
+	mq := []string{}
+	for _, line := range strings.Split(string(portageQuery), "\n") {
+		name, version, ok := splitPortageAtom(strings.TrimSpace(line))
+		if !ok {
+			continue
+		}
+		mq = append(mq, fmt.Sprintf("%s,%s", name, version))
+	}
+	return []byte(strings.Join(mq, "\n"))
+}
+
+// splitPortageAtom splits a portage atom like 'sys-libs/ncurses-6.4-r1:0/6'
+// into the package name 'sys-libs/ncurses' and the version '6.4-r1', the slot
+// and repository of the atom, if any, are discarded
+func splitPortageAtom(atom string) (string, string, bool) {
+	if i := strings.Index(atom, ":"); i != -1 {
+		atom = atom[:i]
+	}
+	match := rexPortageAtom.FindStringSubmatch(atom)
+	if len(match) != 3 {
+		return "", "", false
+	}
+	return match[1], match[2], true
+}
+
+func (c *cliState) checkPortageVardb(cfg *packageManifestConfig) bool {
+	info, err := os.Stat(cfg.path(portageVardb))
+	if err != nil {
+		c.Log.Debugw("unable to find portage database", "error", err)
+		return false
+	}
+	return info.IsDir()
+}
+
+// checkNsenter verifies that we can enter the mount and PID namespaces of the
+// provided process, this requires the nsenter command and root privileges
+func checkNsenter(ctx context.Context, pid int) error {
+	if _, err := exec.LookPath("nsenter"); err != nil {
+		return errors.New(
+			"unable to find nsenter, it is required to generate a package manifest from a process",
+		)
+	}
+
+	out, err := exec.CommandContext(ctx, "nsenter",
+		"--target", strconv.Itoa(pid), "--mount", "--pid", "true",
+	).CombinedOutput()
+	if err != nil {
+		return errors.Wrapf(err,
+			"unable to enter the namespaces of process %d, root privileges are required (%s)",
+			pid, strings.TrimSpace(string(out)),
+		)
+	}
+	return nil
+}
+
+// checkChroot verifies that we can execute commands inside the provided root
+// filesystem via chroot, which requires root privileges
+func checkChroot(ctx context.Context, root string) error {
+	if _, err := exec.LookPath("chroot"); err != nil {
+		return errors.New(
+			"unable to find chroot, it is required to execute the package managers of a root filesystem",
+		)
+	}
+
+	out, err := exec.CommandContext(ctx, "chroot", root, "true").CombinedOutput()
+	if err != nil {
+		return errors.Wrapf(err,
+			"unable to chroot into %s, root privileges are required (%s)",
+			root, strings.TrimSpace(string(out)),
+		)
+	}
+	return nil
+}
+
+// ManifestFromPID generates a package manifest as seen by the process with the
+// provided PID, this is useful to scan the packages of other mount namespaces
+func (c *cliState) ManifestFromPID(pid int, opts ...PackageManifestOption) (*api.PackageManifest, error) {
+	return c.GeneratePackageManifest(append(opts, WithTargetPID(pid))...)
+}
+
+// GeneratePackageManifestFromDpkgStatus generates a package manifest from a dpkg
+// status file, like a copy of /var/lib/dpkg/status from an air-gapped machine or
+// a disk image, without running dpkg-query, the provided operating system is the
+// one the packages are reported for since it can't be detected from the file
+func (c *cliState) GeneratePackageManifestFromDpkgStatus(
+	path string, osInfo OS,
+) (*api.PackageManifest, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to open dpkg status file")
+	}
+	defer file.Close()
+
+	query, err := formatDpkgStatus(file)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to read dpkg status file")
+	}
+
+	cfg := &packageManifestConfig{osInfo: &osInfo}
+	manifest := &api.PackageManifest{OsPkgInfoList: c.parsePackageQuery(cfg, query)}
+	c.Log.Debugw("package manifest from dpkg status file",
+		"path", path, "total_pkgs", len(manifest.OsPkgInfoList))
+	return manifest, nil
+}
+
+// isEndOfLifeOS returns true if the provided operating system is listed
+// in the EndOfLifeOperatingSystems table
+func isEndOfLifeOS(osInfo *OS) bool {
+	for _, version := range EndOfLifeOperatingSystems[osInfo.Name] {
+		if osInfo.Version == version || strings.HasPrefix(osInfo.Version, version+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// isYumDistro returns true if the provided operating system is one of the
+// distro versions where yum is preferred over rpm
+func isYumDistro(osInfo *OS) bool {
+	for _, version := range yumDistroVersions[osInfo.Name] {
+		if osInfo.Version == version || strings.HasPrefix(osInfo.Version, version+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// isImmutableOS returns true if the provided operating system is one of
+// the ImmutableOperatingSystems where packages are not separately managed
+func isImmutableOS(osInfo *OS) bool {
+	for _, name := range ImmutableOperatingSystems {
+		if osInfo.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// isRollingReleaseOS returns true if the provided operating system is one of
+// the RollingReleaseOperatingSystems, it must be checked before any mapping
+func isRollingReleaseOS(osInfo *OS) bool {
+	for _, name := range RollingReleaseOperatingSystems {
+		if osInfo.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// RemoveInactivePackagesFromManifest returns a copy of the provided manifest without
+// the kernel packages that are installed but not active, it also returns whether the
+// manifest was modified and the list of packages that were removed
+func (c *cliState) RemoveInactivePackagesFromManifest(
+	manifest *api.PackageManifest, manager string,
+) (*api.PackageManifest, bool, []api.OsPkgInfo) {
+	return c.removeInactivePackages(context.Background(), manifest, manager)
+}
+
+func (c *cliState) removeInactivePackages(ctx context.Context,
+	manifest *api.PackageManifest, manager string,
+) (*api.PackageManifest, bool, []api.OsPkgInfo) {
+	// Detect Active Kernel
+	//
+	// The default behavior of most linux distros is to keep the last N kernel packages
+	// installed for users that need to fallback in case the new kernel do not boot.
+	// However, the presence of the package does not mean that kernel is active.
+	// We must continue to allow the standard kernel package preservation behavior
+	// without providing false-positives of vulnerabilities that are not active.
+	//
+	// We will try to detect the active kernel and remove any other installed-inactive
+	// kernel from the generated package manifest
+	activeKernel, detected := c.activeKernelForSuppression(ctx)
+	c.Event.AddFeatureField("active_kernel", activeKernel)
+	if !detected {
+		return manifest, false, nil
+	}
+
+	var (
+		newManifest = new(api.PackageManifest)
+		removed     []api.OsPkgInfo
+	)
+	for i, pkg := range manifest.OsPkgInfoList {
+		if isInactiveKernelPackage(pkg, manager, activeKernel) {
+			// this package is NOT the active kernel
+			c.Log.Warnw("inactive kernel package detected, removing from generated pkg manifest",
+				"pkg_name", pkg.Pkg,
+				"pkg_version", pkg.PkgVer,
+				"active_kernel", activeKernel,
+			)
+			c.Event.AddFeatureField(
+				fmt.Sprintf("kernel_suppressed_%d", i),
+				api.JoinPkg(pkg.Pkg, pkg.PkgVer))
+			removed = append(removed, pkg)
+			continue
+		}
+
+		newManifest.OsPkgInfoList = append(newManifest.OsPkgInfoList, pkg)
+	}
+
+	modified := len(removed) != 0
+	if modified {
+		c.Log.Debugw("package-manifest modified", "raw", newManifest)
+	}
+	return newManifest, modified, removed
+}
+
+// InactiveKernelPackages returns the detected active kernel and the list of packages
+// from the provided manifest that would be suppressed as inactive kernels during the
+// generation of a package manifest, the manifest is not modified
+func (c *cliState) InactiveKernelPackages(manifest *api.PackageManifest, manager string) (string, []api.OsPkgInfo) {
+	activeKernel, detected := c.activeKernelForSuppression(context.Background())
+	if !detected {
+		return activeKernel, nil
+	}
+
+	var inactive []api.OsPkgInfo
+	for _, pkg := range manifest.OsPkgInfoList {
+		if isInactiveKernelPackage(pkg, manager, activeKernel) {
+			inactive = append(inactive, pkg)
+		}
+	}
+	return activeKernel, inactive
+}
+
+// isInactiveKernelPackage returns true if the provided package is a kernel
+// package, for the provided package manager, that is NOT the active kernel
+func isInactiveKernelPackage(pkg api.OsPkgInfo, manager, activeKernel string) bool {
+	switch manager {
+	case "rpm", "yum":
+		return array.ContainsStr(rpmKernelPackages, pkg.Pkg) && !kernelVersionsMatch(activeKernel, pkg.PkgVer)
+	case "dpkg-query":
+		// the name of kernel packages have the kernel version, meta packages,
+		// like linux-image-amd64, don't and they are not kernels themselves,
+		// manifests not generated by us can have multiarch names, like
+		// linux-image-5.4.0-1045-aws:amd64, the qualifier is not the version
+		name, _ := splitDpkgArch(pkg.Pkg, "")
+		if m := rexDpkgKernelPackage.FindStringSubmatch(name); m != nil {
+			return !kernelVersionsMatch(activeKernel, m[1])
+		}
+	case "pacman":
+		if rexPacmanKernelPackage.MatchString(pkg.Pkg) {
+			return !kernelVersionsMatch(activeKernel, pacmanKernelRelease(pkg.PkgVer))
+		}
+	}
+	return false
+}
+
+// pacmanKernelRelease returns the kernel release, as reported by 'uname -r', of
+// the provided version of a pacman kernel package, the last '.' of the version
+// of Arch kernels separates the version from the Arch patch level, like the
+// version 6.5.7.arch1-1 of the release 6.5.7-arch1-1, kernels without patch
+// level, like 6.1.58-1 of the linux-lts package, are returned as is
+func pacmanKernelRelease(pkgVer string) string {
+	if m := rexPacmanKernelPatchLevel.FindStringSubmatch(pkgVer); m != nil {
+		return m[1] + "-" + m[2]
+	}
+	return pkgVer
+}
+
+// kernelVersionCore returns the 'version-release' core of the provided kernel
+// version, that is, without the epoch of the package version and without the
+// architecture and flavor suffixes that 'uname -r' appends to the kernel version
+//
+// Examples:
+//
+// RHEL   uname: 4.18.0-372.9.1.el8_6.x86_64    core: 4.18.0-372.9.1.el8_6
+// Debian uname: 5.10.0-21-cloud-amd64          core: 5.10.0-21-cloud
+// SUSE   uname: 5.14.21-150400.24.46-default   core: 5.14.21-150400.24.46
+func kernelVersionCore(version string) string {
+	version = removeEpochFromPkgVersion(strings.TrimSpace(version))
+	version = rexKernelArchSuffix.ReplaceAllString(version, "")
+	return rexKernelFlavorSuffix.ReplaceAllString(version, "")
+}
+
+// kernelVersionsMatch compares the core of the active kernel and the version of
+// a kernel package, some distros like SUSE add a rebuild counter to the release
+// of the package that is not part of the kernel version, e.g. 150400.24.46.1
+func kernelVersionsMatch(activeKernel, version string) bool {
+	active, pkg := kernelVersionCore(activeKernel), kernelVersionCore(version)
+	if active == "" || pkg == "" {
+		return false
+	}
+	return active == pkg ||
+		strings.HasPrefix(pkg, active+".") ||
+		strings.HasPrefix(active, pkg+".")
+}
+
+// activeKernelForSuppression detects the active kernel and verifies that it has
+// the KernelVersionFormat, otherwise, it returns false to skip the suppression
+func (c *cliState) activeKernelForSuppression(ctx context.Context) (string, bool) {
+	activeKernel, detected := c.detectActiveKernel(ctx)
+	if !detected {
+		return activeKernel, false
+	}
+
+	if !KernelVersionFormat.MatchString(activeKernel) {
+		c.Log.Warnw("unexpected active kernel format, skipping kernel suppression",
+			"active_kernel", activeKernel,
+		)
+		c.Event.AddFeatureField("unexpected_kernel_format", true)
+		return activeKernel, false
+	}
+	return activeKernel, true
+}
+
+// detectActiveKernel detects the active kernel via 'uname -r' and cross-checks
+// it with the kernel image from /proc/cmdline, which is used as a fallback
+func (c *cliState) detectActiveKernel(ctx context.Context) (string, bool) {
+	cmdlineKernel, cmdlineFound := c.readKernelFromCmdline()
+
+	kernel, err := exec.CommandContext(ctx, "uname", "-r").Output()
+	if err != nil {
+		if cmdlineFound {
+			c.Log.Infow("unable to run 'uname -r', using active kernel from cmdline",
+				"kernel", cmdlineKernel,
+				"error", err,
+			)
+			return cmdlineKernel, true
+		}
+		c.Log.Warnw("unable to detect active kernel",
+			"cmd", "uname -r",
+			"error", err,
+		)
+		return "", false
+	}
+
+	unameKernel := strings.TrimSuffix(string(kernel), "\n")
+	if cmdlineFound && cmdlineKernel != unameKernel {
+		c.Log.Warnw("active kernel from uname doesn't match the kernel from cmdline",
+			"uname", unameKernel,
+			"cmdline", cmdlineKernel,
+		)
+	}
+	return unameKernel, true
+}
+
+func (c *cliState) readKernelFromCmdline() (string, bool) {
+	cmdline, err := ioutil.ReadFile(procCmdline)
+	if err != nil {
+		c.Log.Debugw("unable to read kernel cmdline", "file", procCmdline, "error", err)
+		return "", false
+	}
+	return kernelFromCmdline(string(cmdline))
+}
+
+// checkMinimumKernelVersion flags the active kernel if its major version is
+// below the minimum of the WithMinimumKernelMajorVersion() option
+func (c *cliState) checkMinimumKernelVersion(cfg *packageManifestConfig) {
+	activeKernel, detected := c.detectActiveKernel(cfg.context())
+	if !detected {
+		return
+	}
 
-		manifest.OsPkgInfoList = append(manifest.OsPkgInfoList,
-			api.OsPkgInfo{
-				Os:     osInfo.Name,
-				OsVer:  osInfo.Version,
-				Pkg:    pkgDetail[0],
-				PkgVer: pkgDetail[1],
+	major, ok := kernelMajorVersion(activeKernel)
+	if !ok {
+		c.Log.Warnw("unable to parse the major version of the active kernel",
+			"active_kernel", activeKernel,
+		)
+		return
+	}
+
+	if major < cfg.minimumKernelMajor {
+		c.Log.Warnw("active kernel is below the minimum version",
+			"active_kernel", activeKernel,
+			"minimum_major_version", cfg.minimumKernelMajor,
+		)
+		c.Event.AddFeatureField("kernel_below_minimum", true)
+		cfg.stats.KernelBelowMinimum = true
+		cfg.addWarning(ManifestWarningKernelBelowMinimum,
+			"active kernel is below the minimum version",
+			map[string]interface{}{
+				"active_kernel":         activeKernel,
+				"minimum_major_version": cfg.minimumKernelMajor,
 			},
 		)
 	}
+}
 
-	c.Event.AddFeatureField("total_manifest_pkgs", len(manifest.OsPkgInfoList))
-	c.Log.Debugw("package-manifest", "raw", manifest)
-	return c.removeInactivePackagesFromManifest(manifest, manager), nil
+// kernelMajorVersion returns the major version of the provided kernel version
+func kernelMajorVersion(kernel string) (int, bool) {
+	idx := strings.IndexByte(kernel, '.')
+	if idx <= 0 {
+		return 0, false
+	}
+	major, err := strconv.Atoi(kernel[:idx])
+	return major, err == nil
 }
 
-func (c *cliState) removeInactivePackagesFromManifest(manifest *api.PackageManifest, manager string) *api.PackageManifest {
-	// Detect Active Kernel
-	//
-	// The default behavior of most linux distros is to keep the last N kernel packages
-	// installed for users that need to fallback in case the new kernel do not boot.
-	// However, the presence of the package does not mean that kernel is active.
-	// We must continue to allow the standard kernel package preservation behavior
-	// without providing false-positives of vulnerabilities that are not active.
-	//
-	// We will try to detect the active kernel and remove any other installed-inactive
-	// kernel from the generated package manifest
-	activeKernel, detected := c.detectActiveKernel()
-	c.Event.AddFeatureField("active_kernel", activeKernel)
-	if !detected {
-		return manifest
+// isWSL returns true if the local host is a Windows Subsystem for Linux (WSL)
+func (c *cliState) isWSL() bool {
+	for _, file := range []string{procVersion, procKernelRelease} {
+		version, err := ioutil.ReadFile(file)
+		if err != nil {
+			c.Log.Debugw("unable to read kernel version", "file", file, "error", err)
+			continue
+		}
+		return isWSLKernel(string(version))
 	}
+	return false
+}
 
-	newManifest := new(api.PackageManifest)
-	for i, pkg := range manifest.OsPkgInfoList {
+// isWSLKernel returns true if the provided kernel version is from WSL, the
+// kernel of WSL 1 and 2 have 'Microsoft' or 'microsoft' in their version
+//
+// Examples of kernel versions from /proc/version:
+//
+// WSL 1: Linux version 4.4.0-19041-Microsoft (Microsoft@Microsoft.com) (gcc version 5.4.0) #1237-Microsoft
+// WSL 2: Linux version 5.15.90.1-microsoft-standard-WSL2 (oe-user@oe-host) (x86_64-msft-linux-gcc (GCC) 9.3.0)
+func isWSLKernel(version string) bool {
+	return strings.Contains(strings.ToLower(version), "microsoft")
+}
 
-		switch manager {
-		case "rpm":
-			kernelPkgName := "kernel"
-			pkgVer := removeEpochFromPkgVersion(pkg.PkgVer)
-			if pkg.Pkg == kernelPkgName && !strings.Contains(activeKernel, pkgVer) {
-				// this package is NOT the active kernel
-				c.Log.Warnw("inactive kernel package detected, removing from generated pkg manifest",
-					"pkg_name", kernelPkgName,
-					"pkg_version", pkg.PkgVer,
-					"active_kernel", activeKernel,
-				)
-				c.Event.AddFeatureField(
-					fmt.Sprintf("kernel_suppressed_%d", i),
-					fmt.Sprintf("%s-%s", pkg.Pkg, pkg.PkgVer))
-				continue
-			}
-		case "dpkg-query":
-			kernelPkgName := "linux-image-"
-			if strings.Contains(pkg.Pkg, kernelPkgName) {
-				// this is a kernel package, trim the package name prefix to get the version
-				kernelVer := strings.TrimPrefix(pkg.Pkg, kernelPkgName)
-
-				if !strings.Contains(activeKernel, kernelVer) {
-					// this package is NOT the active kernel
-					c.Log.Warnw("inactive kernel package detected, removing from generated pkg manifest",
-						"pkg_name", kernelPkgName,
-						"pkg_version", pkg.PkgVer,
-						"active_kernel", activeKernel,
-					)
-					c.Event.AddFeatureField(
-						fmt.Sprintf("kernel_suppressed_%d", i),
-						fmt.Sprintf("%s-%s", pkg.Pkg, pkg.PkgVer))
-					continue
-				}
+// kernelFromCmdline extracts the kernel version from the kernel image of the
+// 'BOOT_IMAGE' parameter of the kernel command line
+//
+// Example of a kernel command line:
+//
+// BOOT_IMAGE=/boot/vmlinuz-5.4.0-42-generic root=UUID=2f7c9c1e ro quiet splash
+func kernelFromCmdline(cmdline string) (string, bool) {
+	for _, param := range strings.Fields(cmdline) {
+		if !strings.HasPrefix(param, "BOOT_IMAGE=") {
+			continue
+		}
+
+		image := path.Base(strings.TrimPrefix(param, "BOOT_IMAGE="))
+		for _, prefix := range []string{"vmlinuz-", "vmlinux-", "kernel-"} {
+			if strings.HasPrefix(image, prefix) {
+				return strings.TrimPrefix(image, prefix), true
 			}
 		}
+	}
+	return "", false
+}
 
-		newManifest.OsPkgInfoList = append(newManifest.OsPkgInfoList, pkg)
+// GetOSInfo detects the operating system information of the local host, or the
+// root filesystem of the WithRootFilesystem() option, the detected operating
+// system is translated by the mapper of the WithOSMapper() option, the rest of
+// the options are ignored
+func (c *cliState) GetOSInfo(opts ...PackageManifestOption) (*OS, error) {
+	cfg := new(packageManifestConfig)
+	for _, opt := range opts {
+		opt.apply(cfg)
 	}
+	return c.getOSInfo(&packageManifestConfig{osMapper: cfg.osMapper, root: cfg.root})
+}
 
-	if len(manifest.OsPkgInfoList) != len(newManifest.OsPkgInfoList) {
-		c.Log.Debugw("package-manifest modified", "raw", newManifest)
+// GetEffectiveOS returns the name and version of the operating system exactly
+// as they are submitted in the packages of a manifest generated with the same
+// options, after all the normalizations like the mapping of the WithOSMapper()
+// option, useful to debug which operating system the assessment API receives
+func (c *cliState) GetEffectiveOS(opts ...PackageManifestOption) (name, version string, err error) {
+	cfg := new(packageManifestConfig)
+	for _, opt := range opts {
+		opt.apply(cfg)
 	}
-	return newManifest
+
+	osInfo, err := c.getOSInfo(cfg)
+	if err != nil {
+		return "", "", err
+	}
+	pkg := ToAssessmentFormat(*osInfo, api.OsPkgInfo{})
+	return pkg.Os, pkg.OsVer, nil
 }
 
-func (c *cliState) detectActiveKernel() (string, bool) {
-	kernel, err := exec.Command("uname", "-r").Output()
+func (c *cliState) getOSInfo(cfg *packageManifestConfig) (*OS, error) {
+	osInfo, err := c.getOSRelease(cfg)
 	if err != nil {
-		c.Log.Warnw("unable to detect active kernel",
-			"cmd", "uname -r",
-			"error", err,
+		return osInfo, err
+	}
+
+	// the VERSION_ID of rolling distros is missing or a snapshot date, like
+	// 20231010 for openSUSE Tumbleweed, that means nothing to the backend
+	if isRollingReleaseOS(osInfo) {
+		c.Log.Debugw("rolling release operating system detected",
+			"os", osInfo.Name, "os_ver", osInfo.Version,
 		)
-		return "", false
+		osInfo.Version = RollingReleaseVersion
+	}
+
+	mapper := cfg.osMapper
+	if mapper == nil {
+		mapper = NewOSMapper()
+	}
+	if mapped := mapper.Map(*osInfo); mapped != *osInfo {
+		c.Log.Debugw("operating system mapped",
+			"os", osInfo.Name, "os_ver", osInfo.Version,
+			"mapped_os", mapped.Name, "mapped_os_ver", mapped.Version,
+		)
+		*osInfo = mapped
+	}
+
+	osInfo.Arch = machineArch(runtime.GOARCH)
+	osInfo.InitSystem = c.detectInitSystem(cfg)
+	return osInfo, nil
+}
+
+// detectInitSystem detects the init system by probing the files and directories
+// that every init system creates, it is best-effort and returns an empty string
+// when the init system is unknown
+func (c *cliState) detectInitSystem(cfg *packageManifestConfig) string {
+	for _, probe := range initSystemProbes {
+		if _, err := os.Stat(cfg.path(probe.path)); err == nil {
+			c.Log.Debugw("init system detected", "init_system", probe.name, "file", probe.path)
+			return probe.name
+		}
 	}
-	return strings.TrimSuffix(string(kernel), "\n"), true
+	c.Log.Debugw("unable to detect init system")
+	return ""
 }
 
-func (c *cliState) GetOSInfo() (*OS, error) {
+// machineArch returns the machine hardware name of the provided Go architecture,
+// if the architecture is not mapped, the Go architecture is returned as is
+//
+// Processes and root filesystems we scan run on the same kernel as the CLI, so
+// the architecture of the CLI binary is the architecture of the scanned system
+func machineArch(goarch string) string {
+	if machine, found := goarchMachines[goarch]; found {
+		return machine
+	}
+	return goarch
+}
+
+func (c *cliState) getOSRelease(cfg *packageManifestConfig) (*OS, error) {
 	osInfo := new(OS)
 
 	c.Log.Debugw("detecting operating system information",
@@ -259,14 +1899,64 @@ func (c *cliState) GetOSInfo() (*OS, error) {
 		"arch", runtime.GOARCH,
 	)
 
-	if fileExists(osReleaseFile) {
-		c.Log.Debugw("parsing os release file", "file", osReleaseFile)
-		return openOsReleaseFile(osReleaseFile)
+	osReleasePath := os.Getenv(OSReleasePathEnv)
+	if osReleasePath != "" && cfg.foreignRoot() {
+		c.Log.Warnw("ignoring os release file from environment variable, it is a file of the local host",
+			"env", OSReleasePathEnv,
+			"file", osReleasePath,
+		)
+		osReleasePath = ""
+	} else if osReleasePath != "" {
+		c.Log.Debugw("parsing os release file from environment variable",
+			"env", OSReleasePathEnv,
+			"file", osReleasePath,
+		)
+	}
+	for _, file := range []string{osReleaseFile, vendorOSReleaseFile} {
+		if osReleasePath != "" {
+			break
+		}
+		if osRelease := cfg.resolvePath(file); fileExists(osRelease) {
+			c.Log.Debugw("parsing os release file", "file", osRelease)
+			osReleasePath = osRelease
+		}
+	}
+
+	if osReleasePath != "" {
+		osInfo, fromName, err := openOsReleaseFile(osReleasePath)
+		if fromName {
+			c.Log.Warnw("os release file without ID, operating system derived from NAME",
+				"file", osReleasePath,
+				"os", osInfo.Name,
+			)
+		}
+		return osInfo, err
+	}
+
+	// check the redhat release file before the system release file, some
+	// distros like CentOS 6 and RHEL 6 ship both and only the former has a
+	// format that we can parse reliably for all of them
+	if redhatRelease := cfg.path(redhatReleaseFile); fileExists(redhatRelease) {
+		c.Log.Debugw("parsing redhat release file", "file", redhatRelease)
+		osInfo, err := openRedhatReleaseFile(redhatRelease)
+		if err == nil {
+			return osInfo, nil
+		}
+		c.Log.Warnw("unable to parse redhat release file", "error", err)
+	}
+
+	if sysRelease := cfg.path(sysReleaseFile); fileExists(sysRelease) {
+		c.Log.Debugw("parsing system release file", "file", sysRelease)
+		return openSystemReleaseFile(sysRelease)
 	}
 
-	if fileExists(sysReleaseFile) {
-		c.Log.Debugw("parsing system release file", "file", sysReleaseFile)
-		return openSystemReleaseFile(sysReleaseFile)
+	if debianVersion := cfg.path(debianVersionFile); fileExists(debianVersion) {
+		c.Log.Debugw("parsing debian version file", "file", debianVersion)
+		osInfo, err := openDebianVersionFile(debianVersion)
+		if err == nil {
+			return osInfo, nil
+		}
+		c.Log.Warnw("unable to parse debian version file", "error", err)
 	}
 
 	msg := `unsupported platform
@@ -300,46 +1990,287 @@ func openSystemReleaseFile(filename string) (*OS, error) {
 	return osInfo, err
 }
 
-func openOsReleaseFile(filename string) (*OS, error) {
+// openRedhatReleaseFile parses the distro and major version of the classic
+// redhat-release file, the distro is mapped to its ID from os-release
+//
+// Example of a redhat-release file:
+//
+// CentOS Linux release 7.9.2009 (Core)
+func openRedhatReleaseFile(filename string) (*OS, error) {
+	content, err := readFirstLine(filename)
+	if err != nil {
+		return new(OS), err
+	}
+
+	m := rexRedhatRelease.FindStringSubmatch(content)
+	if m == nil {
+		return new(OS), errors.Errorf("unknown redhat release format '%s'", content)
+	}
+
+	distro := strings.ToLower(m[1])
+	osInfo := &OS{Name: strings.Fields(distro)[0], Version: m[2]}
+	for prefix, name := range redhatReleaseDistros {
+		if strings.HasPrefix(distro, prefix) {
+			osInfo.Name = name
+			break
+		}
+	}
+	return osInfo, nil
+}
+
+// openDebianVersionFile parses the major version of the debian_version file,
+// testing and unstable releases like 'bookworm/sid' are not supported
+func openDebianVersionFile(filename string) (*OS, error) {
+	content, err := readFirstLine(filename)
+	if err != nil {
+		return new(OS), err
+	}
+
+	m := rexDebianVersion.FindStringSubmatch(content)
+	if m == nil {
+		return new(OS), errors.Errorf("unknown debian version format '%s'", content)
+	}
+	return &OS{Name: "debian", Version: m[1]}, nil
+}
+
+func readFirstLine(filename string) (string, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	s := bufio.NewScanner(f)
+	s.Scan()
+	return strings.TrimSpace(s.Text()), s.Err()
+}
+
+// openOsReleaseFile parses the provided os-release file, it returns true when the
+// file doesn't have an ID field and the operating system was derived from NAME
+func openOsReleaseFile(filename string) (*OS, bool, error) {
 	osInfo := new(OS)
 
 	f, err := os.Open(filename)
 	if err != nil {
-		return osInfo, err
+		return osInfo, false, err
 	}
 
 	defer f.Close()
 
+	var name string
 	s := bufio.NewScanner(f)
 	for s.Scan() {
 		if m := rexNameFromID.FindStringSubmatch(s.Text()); m != nil {
-			osInfo.Name = strings.Trim(m[1], `"`)
+			osInfo.Name = trimOsReleaseValue(m[1])
 		} else if m := rexVersionID.FindStringSubmatch(s.Text()); m != nil {
-			osInfo.Version = strings.Trim(m[1], `"`)
+			osInfo.Version = trimOsReleaseValue(m[1])
+		} else if m := rexName.FindStringSubmatch(s.Text()); m != nil {
+			name = trimOsReleaseValue(m[1])
 		}
 	}
 
-	return osInfo, err
+	// some minimal or customized images don't have the ID field, when that
+	// happens, we derive a best-effort identifier from the NAME field by
+	// using its first word, e.g. NAME="Debian GNU/Linux" => debian
+	if osInfo.Name == "" {
+		if fields := strings.Fields(name); len(fields) > 0 {
+			osInfo.Name = strings.ToLower(fields[0])
+			return osInfo, true, err
+		}
+	}
+
+	return osInfo, false, err
+}
+
+// trimOsReleaseValue removes the surrounding whitespaces, carriage returns (files
+// edited on Windows) and quotes (double or single) from an os-release value, if
+// the value is not quoted, we also remove any trailing inline comment
+func trimOsReleaseValue(value string) string {
+	value = strings.TrimSpace(value)
+	if len(value) == 0 {
+		return value
+	}
+
+	if quote := value[0]; quote == '"' || quote == '\'' {
+		if end := strings.IndexByte(value[1:], quote); end != -1 {
+			return value[1 : end+1]
+		}
+		return strings.TrimSpace(value[1:])
+	}
+
+	if idx := strings.Index(value, " #"); idx != -1 {
+		value = strings.TrimSpace(value[:idx])
+	}
+	return value
 }
 
+// DetectPackageManager detects the first supported package manager of the local host
 func (c *cliState) DetectPackageManager() (string, error) {
+	return c.detectPackageManager(new(packageManifestConfig))
+}
+
+func (c *cliState) detectPackageManager(cfg *packageManifestConfig) (string, error) {
 	c.Log.Debugw("detecting package-manager")
 
+	// when we know the distro, we map it directly to its package manager and
+	// only confirm that it exists, instead of probing every package manager,
+	// this is faster and selects the right one on mixed systems
+	if manager, found := c.distroPackageManager(cfg); found {
+		return manager, nil
+	}
+
+	// a foreign root filesystem, like a merged overlay, could have databases
+	// from multiple package managers coming from different layers, we pick
+	// the one that has the most recently modified database
+	if cfg.foreignRoot() {
+		if manager, found := c.detectPackageManagerFromDB(cfg); found {
+			return manager, nil
+		}
+	}
+
+	detected := c.detectedPackageManagers(cfg)
+	switch len(detected) {
+	case 0:
+		msg := "unable to find supported package managers."
+		msg = fmt.Sprintf("%s Supported package managers are %s.",
+			msg, strings.Join(SupportedPackageManagers, ", "))
+		return "", errors.New(msg)
+	case 1:
+		return detected[0], nil
+	}
+
+	// mixed systems, like rpm installed on a Debian box, could produce the
+	// wrong package manifest if the distro is unknown
+	c.Log.Warnw("multiple package managers detected, the package manifest could be incomplete",
+		"package-managers", detected,
+	)
+	cfg.addWarning(ManifestWarningMultiplePackageManagers,
+		"multiple package managers detected, the package manifest could be incomplete",
+		map[string]interface{}{"package_managers": detected},
+	)
+	c.Event.AddFeatureField("ambiguous_package_managers", strings.Join(detected, ","))
+	return detected[0], nil
+}
+
+// DetectedPackageManagers returns all the supported package managers found on
+// the local host, useful to diagnose hosts with multiple package managers, it
+// returns an empty list when none is found
+func (c *cliState) DetectedPackageManagers() []string {
+	return c.detectedPackageManagers(new(packageManifestConfig))
+}
+
+func (c *cliState) detectedPackageManagers(cfg *packageManifestConfig) []string {
+	detected := []string{}
 	for _, manager := range SupportedPackageManagers {
-		if c.checkPackageManager(manager) {
+		if c.checkPackageManager(cfg, manager) {
 			c.Log.Debugw("detected", "package-manager", manager)
-			return manager, nil
+			detected = append(detected, manager)
+		}
+	}
+	c.Log.Debugw("detected package managers", "package-managers", detected)
+	return detected
+}
+
+// distroPackageManager returns the package manager of the detected distro, from
+// the distroPackageManagers table, if it can be executed to query packages
+func (c *cliState) distroPackageManager(cfg *packageManifestConfig) (string, bool) {
+	if cfg.osInfo == nil {
+		return "", false
+	}
+
+	manager, found := distroPackageManagers[cfg.osInfo.Name]
+	if !found {
+		return "", false
+	}
+
+	// older distros are scanned with the same view of yum, when it is available
+	if manager == "rpm" && isYumDistro(cfg.osInfo) && c.checkPackageManager(cfg, "yum") {
+		manager = "yum"
+	}
+
+	if !c.checkPackageManager(cfg, manager) {
+		c.Log.Debugw("package-manager of the distro not found, probing all package managers",
+			"package-manager", manager,
+			"os", cfg.osInfo.Name,
+		)
+		return "", false
+	}
+
+	c.Log.Infow("selected package-manager of the distro",
+		"package-manager", manager,
+		"os", cfg.osInfo.Name,
+	)
+	return manager, true
+}
+
+// detectPackageManagerFromDB detects the package manager whose database is not
+// empty and was modified most recently, and that can be executed to query it,
+// returns false if no database is found
+//
+// This detection is used for root filesystems other than the one from the local
+// host, like the root of a process from the WithTargetPID() option, since its
+// layers could have databases from multiple package managers
+func (c *cliState) detectPackageManagerFromDB(cfg *packageManifestConfig) (string, bool) {
+	type packageDB struct {
+		manager string
+		modTime time.Time
+	}
+	var databases []packageDB
+
+	for manager, files := range packageDBFiles {
+		for _, file := range files {
+			// files could be patterns, like the category directories of portage
+			matches, _ := filepath.Glob(cfg.path(file))
+			for _, match := range matches {
+				info, err := os.Stat(match)
+				if err != nil || (info.Mode().IsRegular() && info.Size() == 0) {
+					continue
+				}
+
+				c.Log.Debugw("package database found",
+					"package-manager", manager,
+					"file", match,
+					"size", info.Size(),
+					"mod_time", info.ModTime(),
+				)
+				databases = append(databases, packageDB{manager, info.ModTime()})
+			}
+		}
+	}
+
+	// the most recently modified databases first, ties are sorted by name
+	sort.Slice(databases, func(i, j int) bool {
+		if databases[i].modTime.Equal(databases[j].modTime) {
+			return databases[i].manager < databases[j].manager
+		}
+		return databases[i].modTime.After(databases[j].modTime)
+	})
+
+	for _, db := range databases {
+		if !c.checkPackageManager(cfg, db.manager) {
+			c.Log.Infow("package database found but package-manager is missing, skipping",
+				"package-manager", db.manager,
+			)
+			continue
 		}
+
+		c.Log.Infow("detected package-manager with the most recently modified database",
+			"package-manager", db.manager,
+			"mod_time", db.modTime,
+		)
+		return db.manager, true
 	}
-	msg := "unable to find supported package managers."
-	msg = fmt.Sprintf("%s Supported package managers are %s.",
-		msg, strings.Join(SupportedPackageManagers, ", "))
-	return "", errors.New(msg)
+	return "", false
 }
 
-func (c *cliState) checkPackageManager(manager string) bool {
+func (c *cliState) checkPackageManager(cfg *packageManifestConfig, manager string) bool {
+	// portage is detected by its database, its query tools are optional
+	if manager == "portage" {
+		return c.checkPortageVardb(cfg)
+	}
+
 	var (
-		cmd    = exec.Command("which", manager)
+		cmd    = cfg.command("which", manager)
 		_, err = cmd.CombinedOutput()
 	)
 	if err != nil {
@@ -353,15 +2284,15 @@ func (c *cliState) checkPackageManager(manager string) bool {
 			return waitStatus.ExitStatus() == 0
 		}
 		c.Log.Warnw("something went wrong with 'which', trying native command")
-		return c.checkPackageManagerWithNativeCommand(manager)
+		return c.checkPackageManagerWithNativeCommand(cfg, manager)
 	}
 	waitStatus := cmd.ProcessState.Sys().(syscall.WaitStatus)
 	return waitStatus.ExitStatus() == 0
 }
 
-func (c *cliState) checkPackageManagerWithNativeCommand(manager string) bool {
+func (c *cliState) checkPackageManagerWithNativeCommand(cfg *packageManifestConfig, manager string) bool {
 	var (
-		cmd    = exec.Command("command", "-v", manager)
+		cmd    = cfg.command("command", "-v", manager)
 		_, err = cmd.CombinedOutput()
 	)
 	if err != nil {
@@ -415,6 +2346,76 @@ func min(a, b int) int {
 	return b
 }
 
+// LoadManifest loads a package manifest previously saved as JSON, for instance
+// with WriteManifestJSON, and validates it before returning it
+func LoadManifest(r io.Reader) (*api.PackageManifest, error) {
+	manifest := new(api.PackageManifest)
+	if err := json.NewDecoder(r).Decode(manifest); err != nil {
+		return nil, errors.Wrap(err, "invalid package manifest json")
+	}
+	if err := manifest.Validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid package manifest")
+	}
+	return manifest, nil
+}
+
+// WriteManifestJSON writes the provided package manifest as indented JSON
+func WriteManifestJSON(w io.Writer, manifest *api.PackageManifest) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return errors.Wrap(encoder.Encode(manifest), "unable to write package manifest json")
+}
+
+// ManifestEnvelope wraps a package manifest with metadata about the host and the
+// generation of the manifest, it is meant to archive manifests, what we submit
+// to the assessment API is only the package manifest
+type ManifestEnvelope struct {
+	Hostname       string               `json:"hostname"`
+	ScanTime       time.Time            `json:"scan_time"`
+	OS             *OS                  `json:"os,omitempty"`
+	PackageManager string               `json:"package_manager"`
+	SDKVersion     string               `json:"sdk_version"`
+	Manifest       *api.PackageManifest `json:"manifest"`
+}
+
+// NewManifestEnvelope wraps the provided package manifest, generated for the
+// provided operating system with the provided package manager, with the hostname,
+// the current time and the version of the SDK
+func NewManifestEnvelope(manifest *api.PackageManifest, osInfo *OS, manager string) *ManifestEnvelope {
+	hostname, _ := os.Hostname()
+	return &ManifestEnvelope{
+		Hostname:       hostname,
+		ScanTime:       time.Now().UTC(),
+		OS:             osInfo,
+		PackageManager: manager,
+		SDKVersion:     Version,
+		Manifest:       manifest,
+	}
+}
+
+// LoadManifestEnvelope loads a package manifest envelope previously saved as
+// JSON with WriteManifestEnvelopeJSON, and validates its package manifest
+func LoadManifestEnvelope(r io.Reader) (*ManifestEnvelope, error) {
+	envelope := new(ManifestEnvelope)
+	if err := json.NewDecoder(r).Decode(envelope); err != nil {
+		return nil, errors.Wrap(err, "invalid package manifest envelope json")
+	}
+	if envelope.Manifest == nil {
+		return nil, errors.New("invalid package manifest envelope: missing manifest")
+	}
+	if err := envelope.Manifest.Validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid package manifest")
+	}
+	return envelope, nil
+}
+
+// WriteManifestEnvelopeJSON writes the provided package manifest envelope as indented JSON
+func WriteManifestEnvelopeJSON(w io.Writer, envelope *ManifestEnvelope) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return errors.Wrap(encoder.Encode(envelope), "unable to write package manifest envelope json")
+}
+
 // fan-out a number of package manifests into multiple requests all at once
 func fanOutHostScans(manifests ...*api.PackageManifest) (api.HostVulnScanPkgManifestResponse, error) {
 	var (
@@ -483,6 +2484,128 @@ func fanOutHostScans(manifests ...*api.PackageManifest) (api.HostVulnScanPkgMani
 	return fanInRes, nil
 }
 
+var (
+	// the number of times a failed manifest batch is retried
+	manifestBatchRetries = 3
+
+	// the time to wait before retrying a failed manifest batch, this
+	// delay is multiplied by the attempt number to back off
+	manifestBatchRetryDelay = 5 * time.Second
+
+	// the maximum number of calls, including retries, that we make to submit
+	// a single manifest, the API has a rate-limit of 10 calls per hour, per
+	// access key
+	manifestMaxCalls = 10
+)
+
+// ManifestSubmissionResult is the aggregated result of submitting a package
+// manifest in multiple batches via SubmitManifestStreaming()
+type ManifestSubmissionResult struct {
+	Response      api.HostVulnScanPkgManifestResponse
+	TotalBatches  int
+	FailedBatches map[int]error
+}
+
+// SubmitManifestStreaming splits the provided package manifest into batches
+// of the provided size and submits them, one at a time, to the assessment API.
+// Batches that fail with a transient error are retried and, after exhausting
+// all retries, the onBatchError callback decides if we continue with the rest
+// of the batches (returning true) or we abort (returning false), a nil callback
+// aborts the submission at the first failed batch. After every processed batch,
+// the onProgress callback is called with the number of batches done and the total
+//
+// The API has a rate-limit of 10 calls per hour, manifests that need more than
+// 10 batches are rejected and retries stop once we reach the limit of calls
+func (c *cliState) SubmitManifestStreaming(
+	ctx context.Context,
+	manifest *api.PackageManifest,
+	batchSize int,
+	onProgress func(done, total int),
+	onBatchError func(batch int, err error) bool,
+) (*ManifestSubmissionResult, error) {
+	if batchSize <= 0 {
+		return nil, errors.New("batch size must be greater than zero")
+	}
+
+	result := &ManifestSubmissionResult{FailedBatches: map[int]error{}}
+	if manifest == nil || len(manifest.OsPkgInfoList) == 0 {
+		c.Log.Infow("empty package manifest, nothing to submit")
+		return result, nil
+	}
+
+	batches := splitPackageManifest(manifest, batchSize)
+	result.TotalBatches = len(batches)
+	if len(batches) > manifestMaxCalls {
+		return result, errors.Errorf(
+			"manifest requires %d batches, the API has a rate-limit of %d calls per hour, increase the batch size",
+			len(batches), manifestMaxCalls,
+		)
+	}
+
+	// every batch needs at least one call, the rest can be used for retries
+	retryBudget := manifestMaxCalls - len(batches)
+	for n, batch := range batches {
+		response, err := c.submitManifestBatch(ctx, batch, &retryBudget)
+		if err != nil {
+			if ctx.Err() != nil {
+				return result, ctx.Err()
+			}
+
+			result.FailedBatches[n] = err
+			if onBatchError == nil || !onBatchError(n, err) {
+				return result, errors.Wrapf(err, "unable to submit manifest batch %d", n+1)
+			}
+		} else {
+			mergeHostVulnScanPkgManifestResponses(&result.Response, &response)
+		}
+
+		if onProgress != nil {
+			onProgress(n+1, len(batches))
+		}
+	}
+
+	return result, nil
+}
+
+// submitManifestBatch submits a single manifest batch, retrying transient
+// errors while the provided budget of retries allows it
+func (c *cliState) submitManifestBatch(ctx context.Context,
+	manifest *api.PackageManifest, retryBudget *int,
+) (response api.HostVulnScanPkgManifestResponse, err error) {
+	for attempt := 0; attempt <= manifestBatchRetries; attempt++ {
+		if attempt > 0 {
+			if !isTransientAPIError(err) || *retryBudget <= 0 {
+				return
+			}
+			*retryBudget--
+
+			c.Log.Warnw("retrying manifest batch", "attempt", attempt, "error", err)
+			select {
+			case <-ctx.Done():
+				return response, ctx.Err()
+			case <-time.After(time.Duration(attempt) * manifestBatchRetryDelay):
+			}
+		}
+
+		if err = ctx.Err(); err != nil {
+			return
+		}
+
+		response, err = c.LwApi.Vulnerabilities.Host.ScanWithContext(ctx, manifest)
+		if err == nil {
+			return
+		}
+	}
+	return
+}
+
+// isTransientAPIError returns true if the provided error is worth retrying,
+// that is, network errors, rate-limited requests and server errors
+func isTransientAPIError(err error) bool {
+	code := api.ErrorStatusCode(err)
+	return code == 0 || code == http.StatusTooManyRequests || code >= 500
+}
+
 func mergeHostVulnScanPkgManifestResponses(to, from *api.HostVulnScanPkgManifestResponse) {
 	// append vulnerabilities from -> to
 	to.Vulns = append(to.Vulns, from.Vulns...)
@@ -0,0 +1,374 @@
+//
+// Author:: Salim Afiune Maya (<afiune@lacework.net>)
+// Copyright:: Copyright 2021, Lacework Inc.
+// License:: Apache License, Version 2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/lacework/go-sdk/api"
+)
+
+// PackageManifestOption configures the generation of a package manifest
+type PackageManifestOption interface {
+	apply(cfg *packageManifestConfig)
+}
+
+type packageManifestFunc func(cfg *packageManifestConfig)
+
+func (fn packageManifestFunc) apply(cfg *packageManifestConfig) {
+	fn(cfg)
+}
+
+type packageManifestConfig struct {
+	nonFatalMissingManager bool
+	nixPackages            bool
+	allPackageManagers     bool
+	endOfLifeCheck         bool
+	failOnEndOfLife        bool
+	targetPID              int
+	root                   string
+	chroot                 bool
+	baseline               *api.PackageManifest
+	baselineTime           time.Time
+	stats                  *PackageManifestStats
+	osInfo                 *OS
+	installedSince         time.Time
+	packageFilter          func(api.OsPkgInfo) bool
+	ctx                    context.Context
+	runner                 packageManagerRunner
+	osMapper               *OSMapper
+	architecture           string
+	skipKernelSuppression  bool
+	minimumKernelMajor     int
+	lockRetries            *int
+	lockRetryDelay         time.Duration
+}
+
+// NativeArchitecture is used with the WithArchitecture() option to include only
+// the packages of the architecture of the host
+const NativeArchitecture = "native"
+
+// WithNonFatalMissingPackageManager makes the generation of a package manifest
+// return an empty manifest plus the ErrNoSupportedPackageManager error when the
+// host doesn't have any supported package manager, instead of a generic error
+func WithNonFatalMissingPackageManager() PackageManifestOption {
+	return packageManifestFunc(func(cfg *packageManifestConfig) {
+		cfg.nonFatalMissingManager = true
+	})
+}
+
+// WithNixPackages enables the enumeration of packages installed via the nix
+// package manager, these packages are added to the manifest with the prefix
+// 'nix:', hosts that don't have nix installed are not affected
+func WithNixPackages() PackageManifestOption {
+	return packageManifestFunc(func(cfg *packageManifestConfig) {
+		cfg.nixPackages = true
+	})
+}
+
+// WithAllPackageManagers queries every supported package manager found on the
+// host, instead of only the first one, and merges their packages, useful for
+// hosts with vendor software installed via a second package manager, like rpm
+// packages on a Debian host, every package is tagged with its package manager
+func WithAllPackageManagers() PackageManifestOption {
+	return packageManifestFunc(func(cfg *packageManifestConfig) {
+		cfg.allPackageManagers = true
+	})
+}
+
+// WithEndOfLifeCheck checks if the detected operating system is end-of-life by
+// looking at the EndOfLifeOperatingSystems table, by default it logs a warning,
+// if failOnEndOfLife is true, it returns the ErrEndOfLifeOS error instead
+func WithEndOfLifeCheck(failOnEndOfLife bool) PackageManifestOption {
+	return packageManifestFunc(func(cfg *packageManifestConfig) {
+		cfg.endOfLifeCheck = true
+		cfg.failOnEndOfLife = failOnEndOfLife
+	})
+}
+
+// WithTargetPID generates the package manifest as seen by the process with the
+// provided PID, package manager commands are executed inside the mount and PID
+// namespaces of the process via nsenter, and files are read from its root
+func WithTargetPID(pid int) PackageManifestOption {
+	return packageManifestFunc(func(cfg *packageManifestConfig) {
+		cfg.targetPID = pid
+		cfg.root = fmt.Sprintf("/proc/%d/root", pid)
+	})
+}
+
+// WithRootFilesystem generates the package manifest of the provided root filesystem,
+// like a container image mounted at /mnt/image, instead of the local host, the
+// package managers of the local host read the databases of the root filesystem,
+// like 'rpm --root' or 'dpkg-query --admindir', the operating system is read from
+// the os-release file of the root filesystem, and, since the kernel of the local
+// host is not the kernel of the root filesystem, kernel packages are not suppressed
+func WithRootFilesystem(root string) PackageManifestOption {
+	return packageManifestFunc(func(cfg *packageManifestConfig) {
+		cfg.root = root
+	})
+}
+
+// WithChroot generates the package manifest of the provided root filesystem, like
+// a mounted disk or image, by executing the package managers of the root filesystem
+// via chroot, so their version specific behaviors are respected, root privileges
+// are required, if chroot is not permitted, the package managers of the local host
+// read the databases of the root filesystem instead
+func WithChroot(root string) PackageManifestOption {
+	return packageManifestFunc(func(cfg *packageManifestConfig) {
+		cfg.chroot = true
+		cfg.root = root
+	})
+}
+
+// WithBaseline provides a previously generated package manifest and the time it
+// was generated, if the database of the package manager hasn't been modified
+// since then, we skip querying the package manager and return the baseline
+func WithBaseline(baseline *api.PackageManifest, generatedAt time.Time) PackageManifestOption {
+	return packageManifestFunc(func(cfg *packageManifestConfig) {
+		cfg.baseline = baseline
+		cfg.baselineTime = generatedAt
+	})
+}
+
+// WithManifestStats collects statistics about the generation of a package
+// manifest into the provided stats
+func WithManifestStats(stats *PackageManifestStats) PackageManifestOption {
+	return packageManifestFunc(func(cfg *packageManifestConfig) {
+		cfg.stats = stats
+	})
+}
+
+// WithInstalledSince includes only the packages that were installed or upgraded
+// after the provided time, packages without an install time are always included
+func WithInstalledSince(since time.Time) PackageManifestOption {
+	return packageManifestFunc(func(cfg *packageManifestConfig) {
+		cfg.installedSince = since
+	})
+}
+
+// WithPackageFilter calls the provided function for every package parsed from the
+// package manager to decide if it is included in the manifest, packages are
+// excluded when the function returns false
+func WithPackageFilter(filter func(api.OsPkgInfo) bool) PackageManifestOption {
+	return packageManifestFunc(func(cfg *packageManifestConfig) {
+		cfg.packageFilter = filter
+	})
+}
+
+// WithContext sets the context used to execute package manager commands, when
+// the context is cancelled, the running command and its children are killed
+func WithContext(ctx context.Context) PackageManifestOption {
+	return packageManifestFunc(func(cfg *packageManifestConfig) {
+		cfg.ctx = ctx
+	})
+}
+
+// WithOSMapper sets the mapper used to translate the detected operating system
+// to the identifiers that the assessment backend expects, by default, we use
+// the mapper returned by NewOSMapper()
+func WithOSMapper(mapper *OSMapper) PackageManifestOption {
+	return packageManifestFunc(func(cfg *packageManifestConfig) {
+		cfg.osMapper = mapper
+	})
+}
+
+// WithArchitecture includes only the packages of the provided architecture, as
+// reported by the package manager, like x86_64 for rpm or amd64 for dpkg, or the
+// packages of the architecture of the host with NativeArchitecture, packages
+// that are architecture independent are always included. The filter applies
+// only to package managers that report the architecture of packages, rpm and
+// dpkg, and it doesn't apply to baselines of the WithBaseline() option
+func WithArchitecture(arch string) PackageManifestOption {
+	return packageManifestFunc(func(cfg *packageManifestConfig) {
+		cfg.architecture = arch
+	})
+}
+
+// WithoutKernelSuppression keeps all the kernel packages in the manifest, by
+// default, kernel packages that are installed but not active are removed to
+// avoid reporting vulnerabilities of kernels that are not running, this option
+// is useful for inventories that need the full list of installed packages
+func WithoutKernelSuppression() PackageManifestOption {
+	return packageManifestFunc(func(cfg *packageManifestConfig) {
+		cfg.skipKernelSuppression = true
+	})
+}
+
+// WithMinimumKernelMajorVersion checks if the major version of the active kernel
+// is below the provided one, in which case, it logs a warning and flags it in the
+// KernelBelowMinimum field of the manifest stats, the check is only advisory
+func WithMinimumKernelMajorVersion(major int) PackageManifestOption {
+	return packageManifestFunc(func(cfg *packageManifestConfig) {
+		cfg.minimumKernelMajor = major
+	})
+}
+
+// WithPackageDBLockRetries configures how many times, and how long to wait, to
+// retry a package manager query that failed because another process holds the
+// lock of the package database, like during package updates, the delay is
+// multiplied by the attempt number to back off, zero retries disables them
+func WithPackageDBLockRetries(retries int, delay time.Duration) PackageManifestOption {
+	return packageManifestFunc(func(cfg *packageManifestConfig) {
+		cfg.lockRetries = &retries
+		cfg.lockRetryDelay = delay
+	})
+}
+
+// command returns the command to execute the provided package manager
+// command, when targeting a process, it is executed inside its namespaces,
+// when targeting a root filesystem, it is executed via chroot or, if chroot
+// is not permitted, the package manager reads the database of the root
+func (cfg *packageManifestConfig) command(name string, args ...string) *exec.Cmd {
+	if cfg.targetPID != 0 {
+		return exec.CommandContext(cfg.context(), "nsenter", append(
+			[]string{"--target", strconv.Itoa(cfg.targetPID), "--mount", "--pid", name},
+			args...,
+		)...)
+	}
+	if cfg.chroot {
+		return exec.CommandContext(cfg.context(), "chroot", append([]string{cfg.root, name}, args...)...)
+	}
+	if cfg.foreignRoot() {
+		switch name {
+		case "rpm":
+			args = append([]string{"--root", cfg.root}, args...)
+		case "yum":
+			args = append([]string{"--installroot", cfg.root}, args...)
+		case "dpkg-query":
+			args = append([]string{"--admindir", cfg.path("/var/lib/dpkg")}, args...)
+		case "pacman":
+			args = append([]string{"--dbpath", cfg.path("/var/lib/pacman")}, args...)
+		}
+	}
+	return exec.CommandContext(cfg.context(), name, args...)
+}
+
+// context returns the context of the WithContext() option or, if it
+// is not provided, a background context
+func (cfg *packageManifestConfig) context() context.Context {
+	if cfg.ctx == nil {
+		return context.Background()
+	}
+	return cfg.ctx
+}
+
+// path returns the provided path as seen by the system we are generating the
+// package manifest for, when targeting a process, it is inside its root
+func (cfg *packageManifestConfig) path(path string) string {
+	if cfg.root != "" {
+		return filepath.Join(cfg.root, path)
+	}
+	return path
+}
+
+// resolvePath returns the path of the provided file inside the root filesystem,
+// like path(), and, if the file is a symlink with an absolute target, like the
+// /etc/os-release symlink to /usr/lib/os-release, it resolves the target inside
+// the root filesystem too, instead of following it to a file of the local host
+func (cfg *packageManifestConfig) resolvePath(path string) string {
+	resolved := cfg.path(path)
+	if !cfg.foreignRoot() {
+		return resolved
+	}
+	target, err := os.Readlink(resolved)
+	if err != nil || !filepath.IsAbs(target) {
+		return resolved
+	}
+	return cfg.path(target)
+}
+
+// foreignRoot returns true when the package manifest is generated for
+// a root filesystem different than the one from the local host
+func (cfg *packageManifestConfig) foreignRoot() bool {
+	return cfg.root != ""
+}
+
+// includesArch returns true if the packages of the provided architecture must
+// be included in the manifest according to the WithArchitecture() option
+func (cfg *packageManifestConfig) includesArch(arch string) bool {
+	switch arch {
+	case "", "noarch", "all", "(none)":
+		// architecture independent packages, like gpg-pubkey for rpm
+		return true
+	}
+
+	switch cfg.architecture {
+	case "":
+		return true
+	case NativeArchitecture:
+		// dpkg uses the same architecture names as Go, rpm uses machine names
+		return arch == runtime.GOARCH || arch == machineArch(runtime.GOARCH)
+	default:
+		return arch == cfg.architecture
+	}
+}
+
+// query executes the provided package manager command and returns its output,
+// the command is killed if the context of the configuration is cancelled
+func (cfg *packageManifestConfig) query(cmd *exec.Cmd) ([]byte, error) {
+	ctx := cfg.context()
+	var runner packageManagerRunner = processGroupRunner{}
+	if cfg.runner != nil {
+		runner = cfg.runner
+	}
+
+	retries, delay := packageDBLockRetries, packageDBLockRetryDelay
+	if cfg.lockRetries != nil {
+		retries, delay = *cfg.lockRetries, cfg.lockRetryDelay
+	}
+
+	for attempt := 0; ; attempt++ {
+		out, err := runner.output(ctx, cmd)
+		if err == nil {
+			return out, nil
+		}
+		if ctx.Err() != nil {
+			return out, errors.Wrapf(ctx.Err(), "package manager query cancelled (cmd: %s)",
+				strings.Join(cmd.Args, " "))
+		}
+		if attempt >= retries || !isPackageDBLockError(err) {
+			return out, wrapPackageManagerError(err)
+		}
+
+		if cfg.stats != nil {
+			cfg.stats.PackageDBLockRetries++
+		}
+		select {
+		case <-ctx.Done():
+			return out, errors.Wrapf(ctx.Err(), "package manager query cancelled (cmd: %s)",
+				strings.Join(cmd.Args, " "))
+		case <-time.After(time.Duration(attempt+1) * delay):
+		}
+
+		// commands can't be executed twice
+		retry := exec.CommandContext(ctx, cmd.Path, cmd.Args[1:]...)
+		retry.Args, retry.Env, retry.Dir = cmd.Args, cmd.Env, cmd.Dir
+		cmd = retry
+	}
+}
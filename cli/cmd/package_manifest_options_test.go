@@ -0,0 +1,118 @@
+//
+// Author:: Salim Afiune Maya (<afiune@lacework.net>)
+// Copyright:: Copyright 2021, Lacework Inc.
+// License:: Apache License, Version 2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package cmd
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPackageManifestConfigDefaults(t *testing.T) {
+	cfg := new(packageManifestConfig)
+	assert.Equal(t,
+		[]string{"rpm", "-qa"},
+		cfg.command("rpm", "-qa").Args)
+	assert.Equal(t, "/etc/os-release", cfg.path("/etc/os-release"))
+}
+
+func TestPackageManifestConfigWithTargetPID(t *testing.T) {
+	cfg := new(packageManifestConfig)
+	WithTargetPID(1234).apply(cfg)
+
+	assert.Equal(t,
+		[]string{"nsenter", "--target", "1234", "--mount", "--pid", "rpm", "-qa"},
+		cfg.command("rpm", "-qa").Args)
+	assert.Equal(t, "/proc/1234/root/etc/os-release", cfg.path("/etc/os-release"))
+}
+
+func TestPackageManifestConfigWithChroot(t *testing.T) {
+	cfg := new(packageManifestConfig)
+	WithChroot("/mnt/image").apply(cfg)
+
+	assert.Equal(t,
+		[]string{"chroot", "/mnt/image", "rpm", "-qa"},
+		cfg.command("rpm", "-qa").Args)
+	assert.Equal(t, "/mnt/image/etc/os-release", cfg.path("/etc/os-release"))
+
+	// without chroot, the package managers read the databases of the root
+	cfg.chroot = false
+	assert.Equal(t,
+		[]string{"rpm", "--root", "/mnt/image", "-qa"},
+		cfg.command("rpm", "-qa").Args)
+	assert.Equal(t,
+		[]string{"dpkg-query", "--admindir", "/mnt/image/var/lib/dpkg", "--show"},
+		cfg.command("dpkg-query", "--show").Args)
+	assert.Equal(t,
+		[]string{"which", "rpm"},
+		cfg.command("which", "rpm").Args)
+}
+
+func TestPackageManifestConfigWithRootFilesystem(t *testing.T) {
+	cfg := new(packageManifestConfig)
+	WithRootFilesystem("/mnt/image").apply(cfg)
+
+	assert.True(t, cfg.foreignRoot())
+	assert.False(t, cfg.chroot)
+	assert.Equal(t,
+		[]string{"rpm", "--root", "/mnt/image", "-qa"},
+		cfg.command("rpm", "-qa").Args)
+	assert.Equal(t,
+		[]string{"dpkg-query", "--admindir", "/mnt/image/var/lib/dpkg", "--show"},
+		cfg.command("dpkg-query", "--show").Args)
+	assert.Equal(t, "/mnt/image/var/lib/rpm/Packages", cfg.path("/var/lib/rpm/Packages"))
+}
+
+func TestCheckChrootWithoutCommands(t *testing.T) {
+	root, err := ioutil.TempDir("", "rootfs")
+	assert.Nil(t, err)
+	defer os.RemoveAll(root)
+
+	// either chroot is not permitted or the root doesn't have any command
+	assert.NotNil(t, checkChroot(context.Background(), root))
+}
+
+func TestCheckNsenterInvalidPID(t *testing.T) {
+	// either nsenter is not installed or the process does not exist
+	assert.NotNil(t, checkNsenter(context.Background(), 999999999))
+}
+
+func TestPackageManifestConfigIncludesArch(t *testing.T) {
+	// all architectures are included by default
+	cfg := new(packageManifestConfig)
+	assert.True(t, cfg.includesArch("i686"))
+	assert.True(t, cfg.includesArch("x86_64"))
+
+	WithArchitecture("x86_64").apply(cfg)
+	assert.True(t, cfg.includesArch("x86_64"))
+	assert.False(t, cfg.includesArch("i686"))
+	// architecture independent packages are always included
+	assert.True(t, cfg.includesArch("noarch"))
+	assert.True(t, cfg.includesArch("all"))
+	assert.True(t, cfg.includesArch("(none)"))
+
+	WithArchitecture(NativeArchitecture).apply(cfg)
+	assert.True(t, cfg.includesArch(runtime.GOARCH))
+	assert.True(t, cfg.includesArch(machineArch(runtime.GOARCH)))
+	assert.False(t, cfg.includesArch("mips"))
+}
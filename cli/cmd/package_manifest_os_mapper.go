@@ -0,0 +1,78 @@
+//
+// Author:: Salim Afiune Maya (<afiune@lacework.net>)
+// Copyright:: Copyright 2021, Lacework Inc.
+// License:: Apache License, Version 2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+// OSMapping maps the operating system detected from a host to the one that
+// the assessment backend expects
+type OSMapping func(osInfo OS) OS
+
+// RenameOS returns a mapping that replaces the name of the operating system
+func RenameOS(name string) OSMapping {
+	return func(osInfo OS) OS {
+		osInfo.Name = name
+		return osInfo
+	}
+}
+
+// defaultOSMappings are the mappings of operating systems that are detected
+// with an identifier that the assessment backend doesn't know about
+var defaultOSMappings = map[string]OSMapping{
+	// the first word of the classic system-release file of Amazon Linux
+	"amazon": RenameOS("amzn"),
+
+	// openSUSE Leap and Tumbleweed are assessed as openSUSE
+	"opensuse-leap":       RenameOS("opensuse"),
+	"opensuse-tumbleweed": RenameOS("opensuse"),
+}
+
+// OSMapper maps the detected operating system, the ID and VERSION_ID from the
+// os-release file, to the identifiers that the assessment backend expects, it
+// starts with a default table of mappings that can be extended or overridden
+type OSMapper struct {
+	mappings map[string]OSMapping
+}
+
+// NewOSMapper returns a new OSMapper with the default table of mappings
+func NewOSMapper() *OSMapper {
+	mapper := &OSMapper{mappings: make(map[string]OSMapping, len(defaultOSMappings))}
+	for name, mapping := range defaultOSMappings {
+		mapper.mappings[name] = mapping
+	}
+	return mapper
+}
+
+// Set adds or overrides the mapping of the operating system with the provided
+// name, a nil mapping removes it so that the operating system is not mapped
+func (m *OSMapper) Set(name string, mapping OSMapping) *OSMapper {
+	if mapping == nil {
+		delete(m.mappings, name)
+		return m
+	}
+	m.mappings[name] = mapping
+	return m
+}
+
+// Map returns the provided operating system mapped to the identifiers that the
+// assessment backend expects, operating systems without a mapping are returned
+// as is
+func (m *OSMapper) Map(osInfo OS) OS {
+	if mapping, found := m.mappings[osInfo.Name]; found {
+		return mapping(osInfo)
+	}
+	return osInfo
+}
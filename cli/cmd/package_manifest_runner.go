@@ -0,0 +1,61 @@
+//
+// Author:: Salim Afiune Maya (<afiune@lacework.net>)
+// Copyright:: Copyright 2021, Lacework Inc.
+// License:: Apache License, Version 2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"os/exec"
+)
+
+// packageManagerRunner executes package manager commands and returns their output
+type packageManagerRunner interface {
+	output(ctx context.Context, cmd *exec.Cmd) ([]byte, error)
+}
+
+// processGroupRunner executes commands in their own process group, when the
+// context is cancelled, the entire process group is killed so that we don't
+// leave orphaned package manager processes holding a lock of their database
+type processGroupRunner struct{}
+
+func (processGroupRunner) output(ctx context.Context, cmd *exec.Cmd) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	setProcessGroup(cmd)
+
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = killProcessGroup(cmd)
+		case <-done:
+		}
+	}()
+
+	err := cmd.Wait()
+	if exitError, ok := err.(*exec.ExitError); ok {
+		exitError.Stderr = stderr.Bytes()
+	}
+	return stdout.Bytes(), err
+}
@@ -19,20 +19,32 @@
 package cmd
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"net/http"
 	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 
 	"github.com/lacework/go-sdk/api"
+	"github.com/lacework/go-sdk/internal/lacework"
 )
 
 func TestRemoveInactivePackagesFromManifest(t *testing.T) {
 	manifest := new(api.PackageManifest)
-	subject := cli.removeInactivePackagesFromManifest(manifest, "rpm")
+	subject, modified, removed := cli.RemoveInactivePackagesFromManifest(manifest, "rpm")
 	assert.Equal(t, manifest, subject)
+	assert.False(t, modified)
+	assert.Empty(t, removed)
 }
 
 func TestRemoveInactivePackagesFromManifestRemoveKernelRPM(t *testing.T) {
@@ -48,8 +60,10 @@ func TestRemoveInactivePackagesFromManifestRemoveKernelRPM(t *testing.T) {
 			},
 		},
 	}
-	subject := cli.removeInactivePackagesFromManifest(manifest, "rpm")
+	subject, modified, removed := cli.RemoveInactivePackagesFromManifest(manifest, "rpm")
 	assert.Empty(t, subject)
+	assert.True(t, modified)
+	assert.Equal(t, manifest.OsPkgInfoList, removed)
 }
 
 func TestRemoveInactivePackagesFromManifestRemoveKernelDPKG(t *testing.T) {
@@ -65,8 +79,10 @@ func TestRemoveInactivePackagesFromManifestRemoveKernelDPKG(t *testing.T) {
 			},
 		},
 	}
-	subject := cli.removeInactivePackagesFromManifest(manifest, "dpkg-query")
+	subject, modified, removed := cli.RemoveInactivePackagesFromManifest(manifest, "dpkg-query")
 	assert.NotEmpty(t, subject)
+	assert.True(t, modified)
+	assert.Equal(t, manifest.OsPkgInfoList[:1], removed)
 	assert.Equal(t, &api.PackageManifest{
 		OsPkgInfoList: []api.OsPkgInfo{
 			api.OsPkgInfo{
@@ -77,10 +93,270 @@ func TestRemoveInactivePackagesFromManifestRemoveKernelDPKG(t *testing.T) {
 	}, subject)
 }
 
+func TestRemoveInactivePackagesFromManifestSUSE(t *testing.T) {
+	activeKernel, detected := cli.activeKernelForSuppression(context.Background())
+	if !detected {
+		t.Skip("unable to detect active kernel")
+	}
+
+	// two installed kernel-default versions, only one is the active kernel
+	active := api.OsPkgInfo{
+		Os: "sles", OsVer: "15.4",
+		Pkg: "kernel-default", PkgVer: "0:" + kernelVersionCore(activeKernel) + ".1",
+	}
+	manifest := &api.PackageManifest{
+		OsPkgInfoList: []api.OsPkgInfo{
+			api.OsPkgInfo{
+				Os: "sles", OsVer: "15.4",
+				Pkg: "kernel-default", PkgVer: "0:1.2.3-150400.24.41.1",
+			},
+			active,
+			api.OsPkgInfo{
+				Os: "sles", OsVer: "15.4",
+				Pkg: "sudo", PkgVer: "0:1.9.9-150400.4.3.1", // not a kernel pkg
+			},
+		},
+	}
+	subject, modified, removed := cli.RemoveInactivePackagesFromManifest(manifest, "rpm")
+	assert.True(t, modified)
+	assert.Equal(t, manifest.OsPkgInfoList[:1], removed)
+	assert.Equal(t, manifest.OsPkgInfoList[1:], subject.OsPkgInfoList)
+}
+
 func TestRemoveInactivePackagesFromManifestUnknownManager(t *testing.T) {
 	manifest := new(api.PackageManifest)
-	subject := cli.removeInactivePackagesFromManifest(manifest, "apk")
+	subject, modified, _ := cli.RemoveInactivePackagesFromManifest(manifest, "apk")
 	assert.Equal(t, manifest, subject)
+	assert.False(t, modified)
+}
+
+func TestKernelVersionFormat(t *testing.T) {
+	for _, kernel := range []string{
+		"4.14.209-160.339.amzn2.x86_64",
+		"4.18.0-372.9.1.el8_6.x86_64",
+		"5.4.0-1045-aws",
+		"5.10.0-21-cloud-amd64",
+		"5.14.21-150400.24.46-default",
+		"5.15.90.1-microsoft-standard-WSL2",
+		"6.1.0",
+		"5.10.52-0-virt",
+	} {
+		assert.True(t, KernelVersionFormat.MatchString(kernel), kernel)
+	}
+
+	for _, kernel := range []string{"", "unknown", "Linux", "v5.4", "5", "5.4.0 (custom)"} {
+		assert.False(t, KernelVersionFormat.MatchString(kernel), kernel)
+	}
+}
+
+func TestKernelMajorVersion(t *testing.T) {
+	cases := []struct {
+		kernel string
+		major  int
+		ok     bool
+	}{
+		{"4.14.209-160.339.amzn2.x86_64", 4, true},
+		{"5.15.90.1-microsoft-standard-WSL2", 5, true},
+		{"3.10.0-1160.el7.x86_64", 3, true},
+		{"unknown", 0, false},
+		{"", 0, false},
+	}
+	for _, kase := range cases {
+		major, ok := kernelMajorVersion(kase.kernel)
+		assert.Equal(t, kase.major, major, kase.kernel)
+		assert.Equal(t, kase.ok, ok, kase.kernel)
+	}
+}
+
+func TestGeneratePackageManifestWithMinimumKernelMajorVersion(t *testing.T) {
+	if _, err := cli.GetOSInfo(); err != nil {
+		t.Skip("unsupported platform")
+	}
+	if _, err := cli.DetectPackageManager(); err != nil {
+		t.Skip("unsupported package manager")
+	}
+	activeKernel, detected := cli.detectActiveKernel(context.Background())
+	major, ok := kernelMajorVersion(activeKernel)
+	if !detected || !ok {
+		t.Skip("unable to detect active kernel")
+	}
+
+	var stats PackageManifestStats
+	_, err := cli.GeneratePackageManifest(WithMinimumKernelMajorVersion(major), WithManifestStats(&stats))
+	assert.Nil(t, err)
+	assert.False(t, stats.KernelBelowMinimum)
+
+	// the check is only advisory
+	stats = PackageManifestStats{}
+	_, err = cli.GeneratePackageManifest(WithMinimumKernelMajorVersion(major+1), WithManifestStats(&stats))
+	assert.Nil(t, err)
+	assert.True(t, stats.KernelBelowMinimum)
+	if assert.NotEmpty(t, stats.Warnings) {
+		assert.Equal(t, ManifestWarningKernelBelowMinimum, stats.Warnings[0].Code)
+	}
+}
+
+func TestIsWSLKernel(t *testing.T) {
+	cases := []struct {
+		expected bool
+		version  string
+	}{
+		{true, "Linux version 4.4.0-19041-Microsoft (Microsoft@Microsoft.com) (gcc version 5.4.0 (GCC) ) #1237-Microsoft Sat Sep 11 14:32:00 PST 2021"},
+		{true, "Linux version 5.15.90.1-microsoft-standard-WSL2 (oe-user@oe-host) (x86_64-msft-linux-gcc (GCC) 9.3.0, GNU ld (GNU Binutils) 2.34.0.20200220) #1 SMP Fri Jan 27 02:56:13 UTC 2023"},
+		{true, "5.10.102.1-microsoft-standard-WSL2\n"},
+		{false, "Linux version 5.4.0-42-generic (buildd@lgw01-amd64-038) (gcc version 9.3.0 (Ubuntu 9.3.0-10ubuntu2)) #46-Ubuntu SMP Fri Jul 10 00:24:02 UTC 2020"},
+		{false, "4.18.0-372.9.1.el8_6.x86_64\n"},
+		{false, ""},
+	}
+	for i, kase := range cases {
+		t.Run(fmt.Sprintf("test case %d", i), func(t *testing.T) {
+			assert.Equal(t, kase.expected, isWSLKernel(kase.version))
+		})
+	}
+}
+
+func TestIsWSL(t *testing.T) {
+	file, err := ioutil.TempFile("", "version")
+	assert.Nil(t, err)
+	defer os.Remove(file.Name())
+	_, err = file.WriteString("Linux version 5.15.90.1-microsoft-standard-WSL2 (oe-user@oe-host)\n")
+	assert.Nil(t, err)
+
+	version, release := procVersion, procKernelRelease
+	defer func() { procVersion, procKernelRelease = version, release }()
+
+	procVersion = file.Name()
+	assert.True(t, cli.isWSL())
+
+	// fallback to the kernel release when the version is not readable
+	procVersion, procKernelRelease = "/path/to/missing/version", file.Name()
+	assert.True(t, cli.isWSL())
+
+	procKernelRelease = "/path/to/missing/osrelease"
+	assert.False(t, cli.isWSL())
+}
+
+func TestKernelFromCmdline(t *testing.T) {
+	cases := []struct {
+		cmdline string
+		kernel  string
+		found   bool
+	}{
+		{"BOOT_IMAGE=/boot/vmlinuz-5.4.0-42-generic root=UUID=2f7c9c1e ro quiet splash\n",
+			"5.4.0-42-generic", true},
+		{"BOOT_IMAGE=(hd0,gpt2)/vmlinuz-4.18.0-305.el8.x86_64 root=/dev/mapper/rhel-root ro crashkernel=auto",
+			"4.18.0-305.el8.x86_64", true},
+		{"root=/dev/nvme0n1p1 ro BOOT_IMAGE=/boot/kernel-6.6.21-gentoo-dist",
+			"6.6.21-gentoo-dist", true},
+		{"BOOT_IMAGE=/vmlinuz root=LABEL=cloudimg-rootfs ro", "", false},
+		{"console=ttyS0 root=/dev/vda1 rw", "", false},
+		{"", "", false},
+	}
+	for _, kase := range cases {
+		kernel, found := kernelFromCmdline(kase.cmdline)
+		assert.Equal(t, kase.found, found, kase.cmdline)
+		assert.Equal(t, kase.kernel, kernel, kase.cmdline)
+	}
+}
+
+func TestInactiveKernelPackages(t *testing.T) {
+	activeKernel, detected := cli.detectActiveKernel(context.Background())
+	if !detected {
+		t.Skip("unable to detect active kernel")
+	}
+
+	manifest := &api.PackageManifest{
+		OsPkgInfoList: []api.OsPkgInfo{
+			api.OsPkgInfo{
+				Os: "ubuntu", OsVer: "18.04",
+				Pkg: "linux-image-5.3.0-1035-aws", PkgVer: "5.3.0-1035.37",
+			},
+			api.OsPkgInfo{
+				Os: "ubuntu", OsVer: "18.04",
+				Pkg: "sudo", PkgVer: "1.8.21p2-3ubuntu1.2", // not a kernel pkg
+			},
+		},
+	}
+	kernel, subject := cli.InactiveKernelPackages(manifest, "dpkg-query")
+	assert.Equal(t, activeKernel, kernel)
+	assert.Equal(t, []api.OsPkgInfo{manifest.OsPkgInfoList[0]}, subject)
+	// the manifest is not modified
+	assert.Len(t, manifest.OsPkgInfoList, 2)
+}
+
+func TestIsInactiveKernelPackage(t *testing.T) {
+	cases := []struct {
+		expected     bool
+		manager      string
+		activeKernel string
+		pkg          api.OsPkgInfo
+	}{
+		{true, "rpm", "4.14.209-160.339.amzn2.x86_64",
+			api.OsPkgInfo{Pkg: "kernel", PkgVer: "0:4.14.203-156.331.amzn2"}},
+		{false, "rpm", "4.14.209-160.339.amzn2.x86_64",
+			api.OsPkgInfo{Pkg: "kernel", PkgVer: "0:4.14.209-160.339.amzn2"}},
+		{false, "rpm", "4.14.209-160.339.amzn2.x86_64",
+			api.OsPkgInfo{Pkg: "openssl", PkgVer: "1:1.0.2k-19.amzn2.0.8"}},
+		{true, "dpkg-query", "5.4.0-1045-aws",
+			api.OsPkgInfo{Pkg: "linux-image-5.3.0-1035-aws", PkgVer: "5.3.0-1035.37"}},
+		{false, "dpkg-query", "5.4.0-1045-aws",
+			api.OsPkgInfo{Pkg: "linux-image-5.4.0-1045-aws", PkgVer: "5.4.0-1045.47"}},
+		// multiarch names
+		{false, "dpkg-query", "5.4.0-1045-aws",
+			api.OsPkgInfo{Pkg: "linux-image-5.4.0-1045-aws:amd64", PkgVer: "5.4.0-1045.47"}},
+		{true, "dpkg-query", "5.4.0-1045-aws",
+			api.OsPkgInfo{Pkg: "linux-image-5.3.0-1035-aws:amd64", PkgVer: "5.3.0-1035.37"}},
+		{false, "dpkg-query", "5.4.0-1045-aws",
+			api.OsPkgInfo{Pkg: "libc6:i386", PkgVer: "2.31-0ubuntu9.9"}},
+		// Arch
+		{false, "pacman", "6.5.7-arch1-1",
+			api.OsPkgInfo{Pkg: "linux", PkgVer: "6.5.7.arch1-1"}},
+		{true, "pacman", "6.5.7-arch1-1",
+			api.OsPkgInfo{Pkg: "linux", PkgVer: "6.5.6.arch2-1"}},
+		{true, "pacman", "6.5.7-arch1-1",
+			api.OsPkgInfo{Pkg: "linux-lts", PkgVer: "6.1.58-1"}},
+		{false, "pacman", "6.1.58-1-lts",
+			api.OsPkgInfo{Pkg: "linux-lts", PkgVer: "6.1.58-1"}},
+		{false, "pacman", "6.5.7-zen1-1-zen",
+			api.OsPkgInfo{Pkg: "linux-zen", PkgVer: "6.5.7.zen1-1"}},
+		{false, "pacman", "6.5.7-arch1-1",
+			api.OsPkgInfo{Pkg: "linux-firmware", PkgVer: "20231030.1a2b3c4-1"}},
+		{false, "apk", "5.10.52-0-virt",
+			api.OsPkgInfo{Pkg: "linux-virt", PkgVer: "5.10.40-r0"}},
+		// RHEL
+		{false, "rpm", "4.18.0-372.9.1.el8_6.x86_64",
+			api.OsPkgInfo{Pkg: "kernel", PkgVer: "4.18.0-372.9.1.el8_6"}},
+		{true, "rpm", "4.18.0-372.9.1.el8_6.x86_64",
+			api.OsPkgInfo{Pkg: "kernel", PkgVer: "4.18.0-372.9.1.el8"}},
+		{true, "rpm", "4.18.0-372.19.1.el8_6.x86_64",
+			api.OsPkgInfo{Pkg: "kernel", PkgVer: "4.18.0-372.9.1.el8_6"}},
+		// SUSE
+		{false, "rpm", "5.14.21-150400.24.46-default",
+			api.OsPkgInfo{Pkg: "kernel", PkgVer: "5.14.21-150400.24.46.1"}},
+		{true, "rpm", "5.14.21-150400.24.46-default",
+			api.OsPkgInfo{Pkg: "kernel", PkgVer: "5.14.21-150400.24.41.1"}},
+		{false, "rpm", "5.14.21-150400.24.46-default",
+			api.OsPkgInfo{Pkg: "kernel-default", PkgVer: "0:5.14.21-150400.24.46.1"}},
+		{true, "rpm", "5.14.21-150400.24.46-default",
+			api.OsPkgInfo{Pkg: "kernel-default-base", PkgVer: "0:5.14.21-150400.24.41.1.150400.24.17.1"}},
+		{false, "rpm", "5.14.21-150400.24.46-default",
+			api.OsPkgInfo{Pkg: "kernel-firmware-all", PkgVer: "0:20220509-150400.4.10.1"}},
+		// Debian
+		{false, "dpkg-query", "5.10.0-21-cloud-amd64",
+			api.OsPkgInfo{Pkg: "linux-image-5.10.0-21-cloud-amd64", PkgVer: "5.10.162-1"}},
+		{true, "dpkg-query", "5.10.0-21-cloud-amd64",
+			api.OsPkgInfo{Pkg: "linux-image-5.10.0-20-cloud-amd64", PkgVer: "5.10.158-2"}},
+		{false, "dpkg-query", "5.10.0-21-cloud-amd64",
+			api.OsPkgInfo{Pkg: "linux-image-cloud-amd64", PkgVer: "5.10.162-1"}}, // meta package
+		{true, "dpkg-query", "5.15.0-1034-aws",
+			api.OsPkgInfo{Pkg: "linux-image-unsigned-5.15.0-1033-aws", PkgVer: "5.15.0-1033.37"}},
+	}
+	for i, kase := range cases {
+		t.Run(fmt.Sprintf("test case %d", i), func(t *testing.T) {
+			assert.Equal(t, kase.expected,
+				isInactiveKernelPackage(kase.pkg, kase.manager, kase.activeKernel))
+		})
+	}
 }
 
 func TestRemoveEpochFromPkgVersion(t *testing.T) {
@@ -95,6 +371,431 @@ func TestRemoveEpochFromPkgVersion(t *testing.T) {
 		removeEpochFromPkgVersion("epoch:version"))
 }
 
+func TestQueryPackageManagerIncludesStderr(t *testing.T) {
+	_, err := queryPackageManager(exec.Command("sh", "-c", "echo 'rpmdb: BDB0113 Thread died' >&2; exit 1"))
+	if assert.NotNil(t, err) {
+		assert.Equal(t,
+			"unable to query packages from package manager (stderr: rpmdb: BDB0113 Thread died): exit status 1",
+			err.Error())
+	}
+
+	// long stderr messages are truncated
+	_, err = queryPackageManager(exec.Command("sh", "-c", "printf '%0600d' 0 >&2; exit 1"))
+	if assert.NotNil(t, err) {
+		assert.Contains(t, err.Error(), "0...): exit status 1")
+		assert.Less(t, len(err.Error()), 600)
+	}
+
+	// commands without stderr return the plain error
+	_, err = queryPackageManager(exec.Command("sh", "-c", "exit 2"))
+	if assert.NotNil(t, err) {
+		assert.Equal(t, "unable to query packages from package manager: exit status 2", err.Error())
+	}
+
+	subject, err := queryPackageManager(exec.Command("sh", "-c", "echo pkg,1.0"))
+	assert.Nil(t, err)
+	assert.Equal(t, "pkg,1.0\n", string(subject))
+}
+
+func TestFormatXbpsQuery(t *testing.T) {
+	subject := formatXbpsQuery([]byte(mockXbpsQueryOutput))
+	assert.Equal(t,
+		"bash,5.1.008_1\n"+
+			"xbps-triggers,0.119_1\n"+
+			"python3-setuptools,57.4.0_1\n"+
+			"libgcc,10.2.1pre1_3",
+		string(subject))
+
+	assert.Empty(t, formatXbpsQuery([]byte("")))
+}
+
+func TestFormatYumQuery(t *testing.T) {
+	subject := formatYumQuery([]byte(mockYumListInstalledOutput))
+	assert.Equal(t,
+		"bash,0:4.1.2-48.el6,x86_64\n"+
+			"java-1.8.0-openjdk-headless,1:1.8.0.275.b01-0.el6_10,x86_64\n"+
+			"gpg-pubkey,0:c105b9de-4e0fd3a3,(none)\n"+
+			"tzdata,0:2020a-1.el6,noarch",
+		string(subject))
+
+	// without header, every line is a package
+	subject = formatYumQuery([]byte("bash.x86_64  4.1.2-48.el6  @base\n"))
+	assert.Equal(t, "bash,0:4.1.2-48.el6,x86_64", string(subject))
+
+	assert.Empty(t, formatYumQuery([]byte("")))
+}
+
+func TestIsYumDistro(t *testing.T) {
+	cases := []struct {
+		expected bool
+		os       OS
+	}{
+		{true, OS{Name: "centos", Version: "6"}},
+		{true, OS{Name: "rhel", Version: "6.10"}},
+		{false, OS{Name: "rhel", Version: "7.9"}},
+		{true, OS{Name: "amzn", Version: "2018.03"}},
+		{false, OS{Name: "amzn", Version: "2"}},
+		{false, mockUbuntu},
+		{false, OS{}},
+	}
+	for _, kase := range cases {
+		assert.Equal(t, kase.expected, isYumDistro(&kase.os), kase.os.String())
+	}
+}
+
+func TestFormatPacmanQuery(t *testing.T) {
+	subject := formatPacmanQuery([]byte(mockPacmanQueryOutput))
+	assert.Equal(t,
+		"bash,5.1.016-1\n"+
+			"glibc,2.38-7\n"+
+			"linux,6.5.7.arch1-1\n"+
+			"linux-lts,6.1.58-1\n"+
+			"python-pip,23.2.1-1",
+		string(subject))
+
+	assert.Empty(t, formatPacmanQuery([]byte("")))
+}
+
+func TestPacmanKernelRelease(t *testing.T) {
+	assert.Equal(t, "6.5.7-arch1-1", pacmanKernelRelease("6.5.7.arch1-1"))
+	assert.Equal(t, "6.5-zen2-1", pacmanKernelRelease("6.5.zen2-1"))
+	assert.Equal(t, "6.1.58-1", pacmanKernelRelease("6.1.58-1"))
+}
+
+func TestFormatDpkgQuery(t *testing.T) {
+	subject := formatDpkgQuery([]byte(mockDpkgQueryStatusOutput))
+	assert.Equal(t,
+		"sudo,1.8.31-1ubuntu1.2,amd64\n"+
+			"vim,2:8.1.2269-1ubuntu5,amd64\n"+
+			"libssl1.1,1.1.1f-1ubuntu2.16,i386\n"+
+			"libc6,2.31-0ubuntu9.9,amd64\n"+
+			"libc6,2.31-0ubuntu9.9,i386\n"+
+			"libgcc-s1,10.3.0-1ubuntu1~20.04,i386",
+		string(subject))
+
+	assert.Empty(t, formatDpkgQuery([]byte("")))
+}
+
+func TestParseDpkgQueryStripsArch(t *testing.T) {
+	cfg := &packageManifestConfig{osInfo: &mockUbuntu}
+	subject := cli.parsePackageQuery(cfg, formatDpkgQuery([]byte(
+		"libc6:amd64,2.31-0ubuntu9.9,amd64,ii\n"+
+			"libstdc++6:i386,10.3.0-1ubuntu1~20.04,i386,ii\n"+
+			"sudo,1.8.31-1ubuntu1.2,amd64,ii\n",
+	)))
+	if assert.Len(t, subject, 3) {
+		assert.Equal(t, "libc6", subject[0].Pkg)
+		assert.Equal(t, "libstdc++6", subject[1].Pkg)
+		assert.Equal(t, "sudo", subject[2].Pkg)
+	}
+}
+
+func TestIsDpkgInstalledAbbrev(t *testing.T) {
+	assert.True(t, isDpkgInstalledAbbrev("ii "))
+	assert.True(t, isDpkgInstalledAbbrev("hi "))
+	assert.True(t, isDpkgInstalledAbbrev("iiR"))
+	assert.False(t, isDpkgInstalledAbbrev("rc "))
+	assert.False(t, isDpkgInstalledAbbrev("un "))
+	assert.False(t, isDpkgInstalledAbbrev("iU "))
+	assert.False(t, isDpkgInstalledAbbrev(""))
+	// the long status of older queries is not an abbreviation
+	assert.False(t, isDpkgInstalledAbbrev("install ok installed"))
+}
+
+func TestFormatDpkgStatus(t *testing.T) {
+	subject, err := formatDpkgStatus(strings.NewReader(mockDpkgStatusFile))
+	if assert.Nil(t, err) {
+		assert.Equal(t,
+			"sudo,1.8.31-1ubuntu1.2,amd64\n"+
+				"vim,2:8.1.2269-1ubuntu5,amd64\n"+
+				"libc6,2.31-0ubuntu9.9,i386",
+			string(subject))
+	}
+
+	subject, err = formatDpkgStatus(strings.NewReader(""))
+	if assert.Nil(t, err) {
+		assert.Empty(t, subject)
+	}
+}
+
+func TestGeneratePackageManifestFromDpkgStatus(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dpkg")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	status := filepath.Join(dir, "status")
+	assert.Nil(t, ioutil.WriteFile(status, []byte(mockDpkgStatusFile), 0644))
+
+	subject, err := cli.GeneratePackageManifestFromDpkgStatus(status, mockUbuntu)
+	if assert.Nil(t, err) && assert.Len(t, subject.OsPkgInfoList, 3) {
+		assert.Equal(t, api.OsPkgInfo{
+			Os: "ubuntu", OsVer: mockUbuntu.Version, Pkg: "sudo", PkgVer: "1.8.31-1ubuntu1.2",
+		}, subject.OsPkgInfoList[0])
+		assert.Equal(t, "libc6", subject.OsPkgInfoList[2].Pkg)
+	}
+
+	_, err = cli.GeneratePackageManifestFromDpkgStatus(filepath.Join(dir, "missing"), mockUbuntu)
+	if assert.NotNil(t, err) {
+		assert.Contains(t, err.Error(), "unable to open dpkg status file")
+	}
+}
+
+func TestSplitDpkgArch(t *testing.T) {
+	cases := []struct {
+		name, arch, expectedName, expectedArch string
+	}{
+		{"libc6:amd64", "", "libc6", "amd64"},
+		{"libc6:i386", "", "libc6", "i386"},
+		{"libc6:i386", "i386", "libc6", "i386"},
+		{"libc6", "amd64", "libc6", "amd64"},
+		{"sudo", "", "sudo", ""},
+	}
+	for _, kase := range cases {
+		t.Run(kase.name, func(t *testing.T) {
+			name, arch := splitDpkgArch(kase.name, kase.arch)
+			assert.Equal(t, kase.expectedName, name)
+			assert.Equal(t, kase.expectedArch, arch)
+		})
+	}
+}
+
+func TestFormatApkQuery(t *testing.T) {
+	subject := formatApkQuery([]byte(mockApkInfoVersionOutput))
+	assert.Equal(t,
+		"musl,1.2.2-r7\n"+
+			"busybox,1.34.1-r3\n"+
+			"py3-foo,0.1.0_git20220101-r0\n"+
+			"go-task,3.12.1_pre20220405-r1\n"+
+			"libfoo-dev,2.0.0_alpha1_p3-r10\n"+
+			"nodejs-current,18.0.0-r0-abc123",
+		string(subject))
+
+	assert.Empty(t, formatApkQuery([]byte("")))
+}
+
+func TestFormatApkQueryAlpine315(t *testing.T) {
+	// on Alpine 3.15, 'apk info' and 'apk info -v' list the packages in a
+	// different order and with different lengths, only the latter is parsed
+	subject := formatApkQuery([]byte(mockApkInfoVersionAlpine315Output))
+	assert.Equal(t,
+		"alpine-baselayout,3.2.0-r18\n"+
+			"alpine-keys,2.4-r1\n"+
+			"apk-tools,2.12.7-r3\n"+
+			"busybox,1.34.1-r3\n"+
+			"ca-certificates-bundle,20211220-r0\n"+
+			"libc-utils,0.7.2-r3\n"+
+			"libcrypto1.1,1.1.1l-r7\n"+
+			"libssl1.1,1.1.1l-r7\n"+
+			"libretls,3.3.4-r2\n"+
+			"musl,1.2.2-r7\n"+
+			"musl-utils,1.2.2-r7\n"+
+			"scanelf,1.3.3-r0\n"+
+			"ssl_client,1.34.1-r3\n"+
+			"zlib,1.2.11-r3\n"+
+			"py3-3to2,1.1.1-r9\n"+
+			"lib-2fa,1.0-r0",
+		string(subject))
+}
+
+func TestSplitApkPackage(t *testing.T) {
+	cases := []struct {
+		pkg, name, version string
+		ok                 bool
+	}{
+		{"musl-1.2.2-r7", "musl", "1.2.2-r7", true},
+		{"py3-3to2-1.1.1-r9", "py3-3to2", "1.1.1-r9", true},
+		{"nodejs-current-18.0.0-r0-abc123", "nodejs-current", "18.0.0-r0-abc123", true},
+		{"musl", "", "", false},
+		{"WARNING: Ignoring APKINDEX", "", "", false},
+		{"", "", "", false},
+	}
+	for _, kase := range cases {
+		name, version, ok := splitApkPackage(kase.pkg)
+		assert.Equal(t, kase.ok, ok, kase.pkg)
+		assert.Equal(t, kase.name, name, kase.pkg)
+		assert.Equal(t, kase.version, version, kase.pkg)
+	}
+}
+
+func TestFormatOpkgQuery(t *testing.T) {
+	subject := formatOpkgQuery([]byte(mockOpkgListInstalledOutput))
+	assert.Equal(t,
+		"base-files,1423-r16886-ef8a9c5e6d\n"+
+			"busybox,1.33.1-4\n"+
+			"kmod-nf-conntrack,5.4.124-1\n"+
+			"libc,1.1.24-4",
+		string(subject))
+
+	assert.Empty(t, formatOpkgQuery([]byte("")))
+}
+
+func TestFormatPortageQuery(t *testing.T) {
+	subject := formatPortageQuery([]byte(mockQlistInstalledOutput))
+	assert.Equal(t,
+		"app-misc/ca-certificates,20230311.3.96.1\n"+
+			"dev-lang/python,3.11.8_p1\n"+
+			"dev-lang/python,3.12.2_p1-r1\n"+
+			"media-libs/libsdl2,2.28.5\n"+
+			"sys-apps/util-linux,2.39.3-r7\n"+
+			"sys-kernel/gentoo-kernel-bin,6.6.21\n"+
+			"sys-libs/ncurses,6.4_p20230401-r1\n"+
+			"x11-libs/gtk+,3.24.41-r1",
+		string(subject))
+
+	assert.Empty(t, formatPortageQuery([]byte("")))
+}
+
+func TestSplitPortageAtom(t *testing.T) {
+	cases := []struct {
+		atom    string
+		name    string
+		version string
+	}{
+		{"sys-apps/sed-4.9", "sys-apps/sed", "4.9"},
+		{"sys-apps/util-linux-2.39.3-r7", "sys-apps/util-linux", "2.39.3-r7"},
+		{"dev-lang/python-3.11.8_p1:3.11", "dev-lang/python", "3.11.8_p1"},
+		{"sys-libs/ncurses-6.4_p20230401-r1:0/6", "sys-libs/ncurses", "6.4_p20230401-r1"},
+		{"dev-libs/openssl-3.0.13:0/3::gentoo", "dev-libs/openssl", "3.0.13"},
+		{"media-libs/libsdl2-2.28.5", "media-libs/libsdl2", "2.28.5"},
+		{"dev-vcs/git-2.44.0_rc1", "dev-vcs/git", "2.44.0_rc1"},
+		{"app-arch/xz-utils-5.4.2b", "app-arch/xz-utils", "5.4.2b"},
+	}
+	for _, kase := range cases {
+		name, version, ok := splitPortageAtom(kase.atom)
+		assert.True(t, ok, kase.atom)
+		assert.Equal(t, kase.name, name, kase.atom)
+		assert.Equal(t, kase.version, version, kase.atom)
+	}
+
+	_, _, ok := splitPortageAtom("virtual/no-version")
+	assert.False(t, ok)
+}
+
+func TestQueryPortageVardb(t *testing.T) {
+	root, err := ioutil.TempDir("", "gentoo")
+	assert.Nil(t, err)
+	defer os.RemoveAll(root)
+
+	for _, pkg := range []string{
+		"sys-apps/util-linux-2.39.3-r7",
+		"dev-lang/python-3.11.8_p1",
+		"sys-apps/-MERGING-sed-4.9",
+	} {
+		assert.Nil(t, os.MkdirAll(filepath.Join(root, portageVardb, pkg), 0755))
+	}
+
+	cfg := &packageManifestConfig{root: root}
+	assert.True(t, cli.checkPortageVardb(cfg))
+
+	subject, err := queryPortageVardb(cfg)
+	assert.Nil(t, err)
+	assert.Equal(t,
+		"dev-lang/python,3.11.8_p1\n"+
+			"sys-apps/util-linux,2.39.3-r7",
+		string(subject))
+
+	assert.False(t, cli.checkPortageVardb(&packageManifestConfig{root: "/nonexistent"}))
+}
+
+func TestParseNixDrvName(t *testing.T) {
+	cases := []struct {
+		drv     string
+		name    string
+		version string
+	}{
+		{"hello-2.10", "hello", "2.10"},
+		{"openssl-1.1.1k", "openssl", "1.1.1k"},
+		{"python3.9-requests-2.25.1", "python3.9-requests", "2.25.1"},
+		{"nix-2.3.15", "nix", "2.3.15"},
+		{"xz-5.2.5-bin", "xz", "5.2.5-bin"},
+		{"etc", "etc", ""},
+		{"system-path", "system-path", ""},
+	}
+	for _, kase := range cases {
+		t.Run(kase.drv, func(t *testing.T) {
+			name, version := parseNixDrvName(kase.drv)
+			assert.Equal(t, kase.name, name)
+			assert.Equal(t, kase.version, version)
+		})
+	}
+}
+
+func TestFormatNixQuery(t *testing.T) {
+	subject := formatNixQuery([]byte(mockNixStoreRequisitesOutput))
+	assert.Equal(t,
+		"nix:openssl,1.1.1k\n"+
+			"nix:bash,4.4-p23\n"+
+			"nix:python3.9-requests,2.25.1",
+		string(subject))
+
+	// output from 'nix-env -q'
+	subject = formatNixQuery([]byte("hello-2.10\nripgrep-12.1.1\n"))
+	assert.Equal(t, "nix:hello,2.10\nnix:ripgrep,12.1.1", string(subject))
+
+	assert.Empty(t, formatNixQuery([]byte("")))
+}
+
+func TestLoadManifestRoundTrip(t *testing.T) {
+	manifest := &api.PackageManifest{
+		OsPkgInfoList: []api.OsPkgInfo{
+			api.OsPkgInfo{Os: "ubuntu", OsVer: "18.04", Pkg: "sudo", PkgVer: "1.8.21p2-3ubuntu1.4"},
+			api.OsPkgInfo{Os: "ubuntu", OsVer: "18.04", Pkg: "openssl", PkgVer: "1.1.1-1ubuntu2.1~18.04.14"},
+		},
+	}
+
+	var buf bytes.Buffer
+	assert.Nil(t, WriteManifestJSON(&buf, manifest))
+
+	subject, err := LoadManifest(&buf)
+	if assert.Nil(t, err) {
+		assert.Equal(t, manifest, subject)
+	}
+}
+
+func TestLoadManifestErrors(t *testing.T) {
+	_, err := LoadManifest(strings.NewReader("{not json"))
+	if assert.NotNil(t, err) {
+		assert.Contains(t, err.Error(), "invalid package manifest json")
+	}
+
+	_, err = LoadManifest(strings.NewReader(
+		`{"os_pkg_info_list": [{"os": "ubuntu", "os_ver": "18.04", "pkg": "sudo", "pkg_ver": ""}]}`,
+	))
+	if assert.NotNil(t, err) {
+		assert.Contains(t, err.Error(), "invalid package manifest")
+	}
+}
+
+func TestManifestEnvelopeRoundTrip(t *testing.T) {
+	manifest := &api.PackageManifest{
+		OsPkgInfoList: []api.OsPkgInfo{
+			api.OsPkgInfo{Os: "ubuntu", OsVer: "18.04", Pkg: "sudo", PkgVer: "1.8.21p2-3ubuntu1.4"},
+		},
+	}
+	envelope := NewManifestEnvelope(manifest,
+		&OS{Name: "ubuntu", Version: "18.04", Arch: "x86_64"}, "dpkg-query")
+	assert.Equal(t, Version, envelope.SDKVersion)
+	assert.False(t, envelope.ScanTime.IsZero())
+
+	var buf bytes.Buffer
+	assert.Nil(t, WriteManifestEnvelopeJSON(&buf, envelope))
+	assert.Contains(t, buf.String(), `"package_manager": "dpkg-query"`)
+
+	subject, err := LoadManifestEnvelope(&buf)
+	if assert.Nil(t, err) {
+		assert.Equal(t, manifest, subject.Manifest)
+		assert.Equal(t, envelope.OS, subject.OS)
+		assert.Equal(t, envelope.Hostname, subject.Hostname)
+		assert.Equal(t, "dpkg-query", subject.PackageManager)
+		assert.True(t, envelope.ScanTime.Equal(subject.ScanTime))
+	}
+
+	_, err = LoadManifestEnvelope(strings.NewReader(`{"hostname": "host"}`))
+	if assert.NotNil(t, err) {
+		assert.Contains(t, err.Error(), "missing manifest")
+	}
+}
+
 func TestSplitPackageManifest(t *testing.T) {
 	cases := []struct {
 		chunks       int
@@ -168,6 +869,108 @@ func TestFanOutHostScans(t *testing.T) {
 	assert.Equal(t, api.HostVulnScanPkgManifestResponse{}, subject)
 }
 
+func TestSubmitManifestStreaming(t *testing.T) {
+	var (
+		calls      int
+		statusCode = http.StatusOK
+		fakeServer = lacework.MockServer()
+	)
+	fakeServer.MockAPI("external/vulnerabilities/scan",
+		func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			if statusCode != http.StatusOK {
+				http.Error(w, `{"ok": false, "message": "mock error"}`, statusCode)
+				return
+			}
+			fmt.Fprintf(w, `{"ok": true, "message": "SUCCESS", "data": []}`)
+		},
+	)
+	defer fakeServer.Close()
+
+	client, err := api.NewClient("test",
+		api.WithToken("TOKEN"),
+		api.WithURL(fakeServer.URL()),
+	)
+	assert.Nil(t, err)
+	cli.LwApi = client
+	retryDelay := manifestBatchRetryDelay
+	manifestBatchRetryDelay = time.Millisecond
+	defer func() {
+		cli.LwApi = nil
+		manifestBatchRetryDelay = retryDelay
+	}()
+
+	manifest := &api.PackageManifest{OsPkgInfoList: make([]api.OsPkgInfo, 5)}
+
+	_, err = cli.SubmitManifestStreaming(context.Background(), manifest, 0, nil, nil)
+	if assert.NotNil(t, err) {
+		assert.Contains(t, err.Error(), "batch size must be greater than zero")
+	}
+
+	// nil and empty manifests don't submit anything
+	for _, m := range []*api.PackageManifest{nil, new(api.PackageManifest)} {
+		subject, err := cli.SubmitManifestStreaming(context.Background(), m, 2, nil, nil)
+		assert.Nil(t, err)
+		assert.Equal(t, 0, subject.TotalBatches)
+	}
+	assert.Equal(t, 0, calls)
+
+	// manifests that need more batches than the rate-limit are rejected
+	_, err = cli.SubmitManifestStreaming(context.Background(),
+		&api.PackageManifest{OsPkgInfoList: make([]api.OsPkgInfo, 11)}, 1, nil, nil)
+	if assert.NotNil(t, err) {
+		assert.Contains(t, err.Error(), "rate-limit of 10 calls per hour")
+	}
+	assert.Equal(t, 0, calls)
+
+	// all batches are submitted and the responses are merged
+	var progress []int
+	subject, err := cli.SubmitManifestStreaming(context.Background(), manifest, 2,
+		func(done, total int) {
+			assert.Equal(t, 3, total)
+			progress = append(progress, done)
+		}, nil,
+	)
+	assert.Nil(t, err)
+	assert.Equal(t, []int{1, 2, 3}, progress)
+	assert.Equal(t, 3, subject.TotalBatches)
+	assert.Empty(t, subject.FailedBatches)
+	assert.True(t, subject.Response.Ok)
+	assert.Equal(t, 3, calls)
+
+	// client errors are not retried, without an error callback
+	// we abort at the first failed batch
+	calls = 0
+	statusCode = http.StatusBadRequest
+	subject, err = cli.SubmitManifestStreaming(context.Background(), manifest, 2, nil, nil)
+	if assert.NotNil(t, err) {
+		assert.Contains(t, err.Error(), "unable to submit manifest batch 1")
+	}
+	assert.Equal(t, 3, subject.TotalBatches)
+	assert.Len(t, subject.FailedBatches, 1)
+	assert.Equal(t, 1, calls)
+
+	// server errors are retried within the limit of calls, 3 batches
+	// leave 7 calls for retries, and the error callback continues with
+	// the rest of the batches
+	calls = 0
+	statusCode = http.StatusInternalServerError
+	subject, err = cli.SubmitManifestStreaming(context.Background(), manifest, 2, nil,
+		func(_ int, _ error) bool { return true },
+	)
+	assert.Nil(t, err)
+	assert.Len(t, subject.FailedBatches, 3)
+	assert.Equal(t, manifestMaxCalls, calls)
+
+	// a cancelled context stops the submission
+	calls = 0
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = cli.SubmitManifestStreaming(ctx, manifest, 2, nil, nil)
+	assert.Equal(t, context.Canceled, err)
+	assert.Equal(t, 0, calls)
+}
+
 func TestMergeHostVulnScanPkgManifestResponses(t *testing.T) {
 	cases := []struct {
 		expected api.HostVulnScanPkgManifestResponse
@@ -225,20 +1028,1114 @@ func TestMergeHostVulnScanPkgManifestResponses(t *testing.T) {
 	}
 }
 
-func TestParseOsRelease(t *testing.T) {
-	file, err := ioutil.TempFile("", "os-release")
-	assert.Nil(t, err)
-	_, err = file.WriteString(mockUbuntuOSReleaseFile)
-	assert.Nil(t, err)
+func TestGeneratePackageManifestWithContextCancelled(t *testing.T) {
+	if _, err := cli.GetOSInfo(); err != nil {
+		t.Skip("unsupported platform")
+	}
+	if _, err := cli.DetectPackageManager(); err != nil {
+		t.Skip("unsupported package manager")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := cli.GeneratePackageManifestWithContext(ctx, WithNonFatalMissingPackageManager())
+	if assert.NotNil(t, err) {
+		assert.ErrorIs(t, err, context.Canceled)
+		assert.Contains(t, err.Error(), "cancelled (cmd: ")
+	}
+}
+
+func TestGeneratePackageManifestNonFatalMissingPackageManager(t *testing.T) {
+	if _, err := cli.GetOSInfo(); err != nil {
+		t.Skip("unsupported platform")
+	}
+
+	// neither the package manager of the distro nor any other is found
+	defer mockPackageManagersInPath(t)()
+
+	// by default, a missing package manager is a generic error
+	_, err := cli.GeneratePackageManifest()
+	if assert.NotNil(t, err) {
+		assert.NotEqual(t, ErrNoSupportedPackageManager, err)
+		assert.Contains(t, err.Error(), "unable to find supported package managers")
+	}
+
+	var stats PackageManifestStats
+	subject, err := cli.GeneratePackageManifest(WithNonFatalMissingPackageManager(), WithManifestStats(&stats))
+	assert.Equal(t, ErrNoSupportedPackageManager, err)
+	assert.Empty(t, subject.OsPkgInfoList)
+	if assert.Len(t, stats.Warnings, 1) {
+		assert.Equal(t, ManifestWarningNoPackageManager, stats.Warnings[0].Code)
+		assert.Contains(t, stats.Warnings[0].Context["error"], "unable to find supported package managers")
+	}
+}
+
+func TestPackageManifestConfigAddWarning(t *testing.T) {
+	// without stats, warnings are discarded
+	cfg := &packageManifestConfig{}
+	cfg.addWarning(ManifestWarningUnparsablePackage, "unable to parse package", nil)
+
+	var stats PackageManifestStats
+	cfg = &packageManifestConfig{stats: &stats}
+	cfg.addWarning(ManifestWarningUnparsablePackage, "unable to parse package",
+		map[string]interface{}{"raw_pkg_details": "foo"})
+	assert.Equal(t, []ManifestWarning{{
+		Code:    ManifestWarningUnparsablePackage,
+		Message: "unable to parse package",
+		Context: map[string]interface{}{"raw_pkg_details": "foo"},
+	}}, stats.Warnings)
+}
+
+func TestPackageDBModTime(t *testing.T) {
+	older, err := ioutil.TempFile("", "pkgdb")
+	assert.Nil(t, err)
+	defer os.Remove(older.Name())
+	newer, err := ioutil.TempFile("", "pkgdb")
+	assert.Nil(t, err)
+	defer os.Remove(newer.Name())
+
+	var (
+		now       = time.Now().Truncate(time.Second)
+		yesterday = now.Add(-24 * time.Hour)
+	)
+	assert.Nil(t, os.Chtimes(older.Name(), yesterday, yesterday))
+	assert.Nil(t, os.Chtimes(newer.Name(), now, now))
+
+	packageDBFiles["test"] = []string{older.Name(), "/path/to/missing/db", newer.Name()}
+	defer delete(packageDBFiles, "test")
+
+	modTime, found := cli.packageDBModTime(new(packageManifestConfig), "test")
+	assert.True(t, found)
+	assert.True(t, now.Equal(modTime))
+
+	_, found = cli.packageDBModTime(new(packageManifestConfig), "unknown")
+	assert.False(t, found)
+}
+
+func TestPackageDBModTimeLocalHost(t *testing.T) {
+	manager, err := cli.DetectPackageManager()
+	if err != nil {
+		t.Skip("unsupported package manager")
+	}
+
+	modTime, err := cli.PackageDBModTime()
+	if _, found := cli.packageDBModTime(new(packageManifestConfig), manager); !found {
+		if assert.NotNil(t, err) {
+			assert.Contains(t, err.Error(), "unable to find the package database of "+manager)
+		}
+		return
+	}
+	assert.Nil(t, err)
+	assert.False(t, modTime.IsZero())
+}
+
+func TestPackageDBModTimePortage(t *testing.T) {
+	root, err := ioutil.TempDir("", "gentoo")
+	assert.Nil(t, err)
+	defer os.RemoveAll(root)
+
+	var (
+		now       = time.Now().Truncate(time.Second)
+		yesterday = now.Add(-24 * time.Hour)
+		sysApps   = filepath.Join(root, portageVardb, "sys-apps")
+		devLang   = filepath.Join(root, portageVardb, "dev-lang")
+	)
+	assert.Nil(t, os.MkdirAll(filepath.Join(sysApps, "sed-4.9"), 0755))
+	assert.Nil(t, os.MkdirAll(filepath.Join(devLang, "python-3.11.8_p1"), 0755))
+	assert.Nil(t, os.Chtimes(sysApps, yesterday, yesterday))
+	assert.Nil(t, os.Chtimes(devLang, now, now))
+
+	modTime, found := cli.packageDBModTime(&packageManifestConfig{root: root}, "portage")
+	assert.True(t, found)
+	assert.True(t, now.Equal(modTime))
+}
+
+func TestDetectPackageManagerMultipleManagers(t *testing.T) {
+	defer mockPackageManagersInPath(t, "rpm", "dpkg-query")()
+
+	// without knowing the distro, the first detected manager is selected
+	subject, err := cli.detectPackageManager(new(packageManifestConfig))
+	assert.Nil(t, err)
+	assert.Equal(t, "dpkg-query", subject)
+
+	// the package manager of the distro is selected
+	subject, err = cli.detectPackageManager(&packageManifestConfig{osInfo: &mockCentos})
+	assert.Nil(t, err)
+	assert.Equal(t, "rpm", subject)
+
+	subject, err = cli.detectPackageManager(&packageManifestConfig{osInfo: &mockUbuntu})
+	assert.Nil(t, err)
+	assert.Equal(t, "dpkg-query", subject)
+}
+
+func TestDetectedPackageManagers(t *testing.T) {
+	cleanup := mockPackageManagersInPath(t)
+	assert.Equal(t, []string{}, cli.DetectedPackageManagers())
+	cleanup()
+
+	defer mockPackageManagersInPath(t, "rpm", "dpkg-query", "apk")()
+	assert.Equal(t, []string{"dpkg-query", "rpm"}, cli.DetectedPackageManagers())
+}
+
+func TestDetectPackageManagerFromDistro(t *testing.T) {
+	defer mockPackageManagersInPath(t, "apk", "rpm")()
+
+	// package managers of the distro that are not probed by default
+	subject, err := cli.detectPackageManager(&packageManifestConfig{osInfo: &OS{Name: "alpine"}})
+	assert.Nil(t, err)
+	assert.Equal(t, "apk", subject)
+
+	// the package manager of the distro is missing, we probe all of them
+	subject, err = cli.detectPackageManager(&packageManifestConfig{osInfo: &mockUbuntu})
+	assert.Nil(t, err)
+	assert.Equal(t, "rpm", subject)
+
+	// unknown distro
+	subject, err = cli.detectPackageManager(&packageManifestConfig{osInfo: &OS{Name: "mydistro"}})
+	assert.Nil(t, err)
+	assert.Equal(t, "rpm", subject)
+}
+
+func TestDetectPackageManagerFromDB(t *testing.T) {
+	root, err := ioutil.TempDir("", "rootfs")
+	assert.Nil(t, err)
+	defer os.RemoveAll(root)
+
+	cfg := &packageManifestConfig{root: root}
+	defer mockPackageManagersInPath(t, "rpm", "dpkg-query", "apk")()
+
+	// no databases found
+	_, found := cli.detectPackageManagerFromDB(cfg)
+	assert.False(t, found)
+
+	var (
+		now       = time.Now().Truncate(time.Second)
+		yesterday = now.Add(-24 * time.Hour)
+		rpmDB     = filepath.Join(root, "var", "lib", "rpm", "Packages")
+		dpkgDB    = filepath.Join(root, "var", "lib", "dpkg", "status")
+	)
+	assert.Nil(t, os.MkdirAll(filepath.Dir(rpmDB), 0755))
+	assert.Nil(t, os.MkdirAll(filepath.Dir(dpkgDB), 0755))
+	assert.Nil(t, ioutil.WriteFile(rpmDB, []byte("rpmdb"), 0644))
+	assert.Nil(t, ioutil.WriteFile(dpkgDB, []byte("Package: sudo"), 0644))
+
+	// the rpm database is the most recently modified
+	assert.Nil(t, os.Chtimes(dpkgDB, yesterday, yesterday))
+	assert.Nil(t, os.Chtimes(rpmDB, now, now))
+	subject, found := cli.detectPackageManagerFromDB(cfg)
+	assert.True(t, found)
+	assert.Equal(t, "rpm", subject)
+
+	// the dpkg database is the most recently modified
+	assert.Nil(t, os.Chtimes(dpkgDB, now, now))
+	assert.Nil(t, os.Chtimes(rpmDB, yesterday, yesterday))
+	subject, found = cli.detectPackageManagerFromDB(cfg)
+	assert.True(t, found)
+	assert.Equal(t, "dpkg-query", subject)
+
+	// empty databases are ignored
+	assert.Nil(t, ioutil.WriteFile(dpkgDB, []byte{}, 0644))
+	subject, found = cli.detectPackageManagerFromDB(cfg)
+	assert.True(t, found)
+	assert.Equal(t, "rpm", subject)
+
+	// the apk database is the most recently modified
+	apkDB := filepath.Join(root, "lib", "apk", "db", "installed")
+	assert.Nil(t, os.MkdirAll(filepath.Dir(apkDB), 0755))
+	assert.Nil(t, ioutil.WriteFile(apkDB, []byte("P:musl"), 0644))
+	assert.Nil(t, os.Chtimes(apkDB, now.Add(time.Hour), now.Add(time.Hour)))
+	subject, found = cli.detectPackageManagerFromDB(cfg)
+	assert.True(t, found)
+	assert.Equal(t, "apk", subject)
+}
+
+func TestDetectPackageManagerFromDBWithoutManager(t *testing.T) {
+	root, err := ioutil.TempDir("", "rootfs")
+	assert.Nil(t, err)
+	defer os.RemoveAll(root)
+
+	var (
+		now       = time.Now().Truncate(time.Second)
+		yesterday = now.Add(-24 * time.Hour)
+		rpmDB     = filepath.Join(root, "var", "lib", "rpm", "Packages")
+		dpkgDB    = filepath.Join(root, "var", "lib", "dpkg", "status")
+	)
+	assert.Nil(t, os.MkdirAll(filepath.Dir(rpmDB), 0755))
+	assert.Nil(t, os.MkdirAll(filepath.Dir(dpkgDB), 0755))
+	assert.Nil(t, ioutil.WriteFile(rpmDB, []byte("rpmdb"), 0644))
+	assert.Nil(t, ioutil.WriteFile(dpkgDB, []byte("Package: sudo"), 0644))
+	assert.Nil(t, os.Chtimes(rpmDB, yesterday, yesterday))
+	assert.Nil(t, os.Chtimes(dpkgDB, now, now))
+
+	// distroless layers have the dpkg database but not dpkg-query
+	defer mockPackageManagersInPath(t, "rpm")()
+	subject, found := cli.detectPackageManagerFromDB(&packageManifestConfig{root: root})
+	assert.True(t, found)
+	assert.Equal(t, "rpm", subject)
+}
+
+// mockPackageManagerRunner records the commands it executes and either
+// returns the canned output and error, or delegates to the provided runner
+type mockPackageManagerRunner struct {
+	runner   packageManagerRunner
+	out      []byte
+	err      error
+	ctx      context.Context
+	commands [][]string
+
+	// errors returned, in order, before returning the output and error above
+	errs []error
+}
+
+func (m *mockPackageManagerRunner) output(ctx context.Context, cmd *exec.Cmd) ([]byte, error) {
+	m.ctx = ctx
+	m.commands = append(m.commands, cmd.Args)
+	if len(m.errs) != 0 {
+		err := m.errs[0]
+		m.errs = m.errs[1:]
+		return nil, err
+	}
+	if m.runner != nil {
+		return m.runner.output(ctx, cmd)
+	}
+	return m.out, m.err
+}
+
+func TestPackageManifestQueryUsesRunner(t *testing.T) {
+	runner := &mockPackageManagerRunner{out: []byte("pkg,1.0\n")}
+	cfg := &packageManifestConfig{runner: runner}
+
+	out, err := cfg.query(exec.Command("rpm", "-qa"))
+	assert.Nil(t, err)
+	assert.Equal(t, "pkg,1.0\n", string(out))
+	assert.Equal(t, [][]string{{"rpm", "-qa"}}, runner.commands)
+	assert.Equal(t, context.Background(), runner.ctx,
+		"a background context must be used when none is provided")
+
+	runner.err = &exec.ExitError{
+		ProcessState: new(os.ProcessState),
+		Stderr:       []byte("rpmdb: BDB0113 Thread died"),
+	}
+	_, err = cfg.query(exec.Command("rpm", "-qa"))
+	if assert.NotNil(t, err) {
+		assert.Contains(t, err.Error(), "rpmdb: BDB0113 Thread died")
+	}
+}
+
+func TestPackageManifestQueryRetriesPackageDBLocks(t *testing.T) {
+	lockErr := &exec.ExitError{
+		ProcessState: new(os.ProcessState),
+		Stderr:       []byte("error: rpmdb: BDB0060 PANIC: fatal region error detected; cannot get shared lock"),
+	}
+	runner := &mockPackageManagerRunner{
+		out:  []byte("pkg,1.0\n"),
+		errs: []error{lockErr, lockErr},
+	}
+	stats := new(PackageManifestStats)
+	cfg := &packageManifestConfig{runner: runner, stats: stats}
+	WithPackageDBLockRetries(2, time.Millisecond).apply(cfg)
+
+	out, err := cfg.query(exec.Command("rpm", "-qa"))
+	assert.Nil(t, err)
+	assert.Equal(t, "pkg,1.0\n", string(out))
+	assert.Equal(t, [][]string{{"rpm", "-qa"}, {"rpm", "-qa"}, {"rpm", "-qa"}}, runner.commands)
+	assert.Equal(t, 2, stats.PackageDBLockRetries)
+
+	// the lock is held longer than the retries
+	runner.commands = nil
+	runner.errs = []error{lockErr, lockErr, lockErr}
+	_, err = cfg.query(exec.Command("rpm", "-qa"))
+	if assert.NotNil(t, err) {
+		assert.Contains(t, err.Error(), "cannot get shared lock")
+	}
+	assert.Len(t, runner.commands, 3)
+
+	// other errors are never retried
+	runner.commands = nil
+	runner.errs = []error{&exec.ExitError{
+		ProcessState: new(os.ProcessState),
+		Stderr:       []byte("dpkg-query: error: parsing file '/var/lib/dpkg/status'"),
+	}}
+	_, err = cfg.query(exec.Command("dpkg-query", "--show"))
+	assert.NotNil(t, err)
+	assert.Len(t, runner.commands, 1)
+}
+
+func TestIsPackageDBLockError(t *testing.T) {
+	for stderr, expected := range map[string]bool{
+		"error: rpmdb: BDB0060 cannot get exclusive lock":                         true,
+		"error: sqlite failure: database is locked":                               true,
+		"dpkg: error: dpkg status database area is locked by another process":     true,
+		"E: Could not get lock /var/lib/dpkg/lock-frontend":                       true,
+		"error: rpmdb: BDB0113 Thread/process 1234/0 failed: BDB1507 Thread died": false,
+		"dpkg-query: error: parsing file '/var/lib/dpkg/status' near line 1":      false,
+	} {
+		err := &exec.ExitError{ProcessState: new(os.ProcessState), Stderr: []byte(stderr)}
+		assert.Equal(t, expected, isPackageDBLockError(err), stderr)
+	}
+	assert.False(t, isPackageDBLockError(context.DeadlineExceeded))
+}
+
+// mockPackageManagersInPath replaces the PATH with a directory that contains
+// only the 'which' command and the provided package managers, it returns a
+// function to restore the PATH and remove the directory
+func mockPackageManagersInPath(t *testing.T, managers ...string) func() {
+	which, err := exec.LookPath("which")
+	if err != nil {
+		t.Skip("which not found")
+	}
+
+	bin, err := ioutil.TempDir("", "bin")
+	assert.Nil(t, err)
+	assert.Nil(t, os.Symlink(which, filepath.Join(bin, "which")))
+	for _, manager := range managers {
+		assert.Nil(t, ioutil.WriteFile(filepath.Join(bin, manager), []byte("#!/bin/sh\n"), 0755))
+	}
+
+	path := os.Getenv("PATH")
+	os.Setenv("PATH", bin)
+	return func() {
+		os.Setenv("PATH", path)
+		os.RemoveAll(bin)
+	}
+}
+
+func TestGeneratePackageManifestAllPackageManagers(t *testing.T) {
+	if _, err := cli.GetOSInfo(); err != nil {
+		t.Skip("unsupported platform")
+	}
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not found")
+	}
+
+	defer mockPackageManagersInPath(t)()
+	bin := os.Getenv("PATH")
+	scripts := map[string]string{
+		"dpkg-query": "curl,7.81.0,amd64,ii \nbash,5.1-6,amd64,ii ",
+		"rpm":        "curl,7.81.0,x86_64\nvendor-agent,0:1.2-3,x86_64",
+	}
+	for manager, out := range scripts {
+		script := fmt.Sprintf("#!/bin/sh\nprintf '%s\\n'\n", out)
+		assert.Nil(t, ioutil.WriteFile(filepath.Join(bin, manager), []byte(script), 0755))
+	}
+
+	var stats PackageManifestStats
+	subject, err := cli.GeneratePackageManifest(
+		WithAllPackageManagers(), WithoutKernelSuppression(), WithManifestStats(&stats),
+	)
+	assert.Nil(t, err)
+
+	sources := map[string]string{}
+	for _, pkg := range subject.OsPkgInfoList {
+		sources[pkg.Pkg] = pkg.Source
+	}
+	assert.Len(t, subject.OsPkgInfoList, 3, "packages of multiple package managers must be added once")
+	assert.Equal(t, "dpkg-query", sources["bash"])
+	assert.Equal(t, "rpm", sources["vendor-agent"])
+	assert.Equal(t, stats.PackageManager, sources["curl"],
+		"duplicated packages must be tagged with the first package manager")
+	assert.Equal(t, 3, stats.PackagesByManager["dpkg-query"]+stats.PackagesByManager["rpm"])
+
+	// by default, only the first package manager is queried
+	stats = PackageManifestStats{}
+	subject, err = cli.GeneratePackageManifest(WithoutKernelSuppression(), WithManifestStats(&stats))
+	assert.Nil(t, err)
+	assert.Len(t, subject.OsPkgInfoList, 2)
+	assert.Empty(t, subject.OsPkgInfoList[0].Source)
+	assert.Nil(t, stats.PackagesByManager)
+}
+
+func TestRemovePackagesInstalledBefore(t *testing.T) {
+	root, err := ioutil.TempDir("", "dpkg")
+	assert.Nil(t, err)
+	defer os.RemoveAll(root)
+
+	var (
+		since     = time.Now().Add(-time.Hour).Truncate(time.Second)
+		yesterday = since.Add(-24 * time.Hour)
+		infoDir   = filepath.Join(root, "var", "lib", "dpkg", "info")
+	)
+	assert.Nil(t, os.MkdirAll(infoDir, 0755))
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(infoDir, "sudo.list"), []byte("/usr/bin/sudo"), 0644))
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(infoDir, "libc6:amd64.list"), []byte("/lib"), 0644))
+	assert.Nil(t, os.Chtimes(filepath.Join(infoDir, "sudo.list"), yesterday, yesterday))
+
+	manifest := &api.PackageManifest{
+		OsPkgInfoList: []api.OsPkgInfo{
+			api.OsPkgInfo{Os: "ubuntu", OsVer: "20.04", Pkg: "sudo", PkgVer: "1.8.31-1ubuntu1.2"},
+			api.OsPkgInfo{Os: "ubuntu", OsVer: "20.04", Pkg: "libc6", PkgVer: "2.31-0ubuntu9.9"},
+			api.OsPkgInfo{Os: "ubuntu", OsVer: "20.04", Pkg: "no-list", PkgVer: "1.0"},
+		},
+	}
+
+	subject := cli.removePackagesInstalledBefore(
+		&packageManifestConfig{root: root}, manifest, "dpkg-query", since,
+	)
+	if assert.Len(t, subject.OsPkgInfoList, 2) {
+		assert.Equal(t, "libc6", subject.OsPkgInfoList[0].Pkg)
+		// packages without install time are included
+		assert.Equal(t, "no-list", subject.OsPkgInfoList[1].Pkg)
+	}
+
+	// package managers that don't track install times include every package
+	subject = cli.removePackagesInstalledBefore(
+		&packageManifestConfig{root: root}, manifest, "apk", since,
+	)
+	assert.Equal(t, manifest, subject)
+}
+
+func TestGeneratePackageManifestWithBaseline(t *testing.T) {
+	if _, err := cli.GetOSInfo(); err != nil {
+		t.Skip("unsupported platform")
+	}
+	manager, err := cli.DetectPackageManager()
+	if err != nil {
+		t.Skip("unsupported package manager")
+	}
+	if _, found := cli.packageDBModTime(new(packageManifestConfig), manager); !found {
+		t.Skip("unknown package database")
+	}
+
+	var (
+		stats    PackageManifestStats
+		baseline = &api.PackageManifest{
+			OsPkgInfoList: []api.OsPkgInfo{
+				api.OsPkgInfo{Os: "ubuntu", OsVer: "18.04", Pkg: "sudo", PkgVer: "1.8.21p2-3ubuntu1.2"},
+			},
+		}
+	)
+
+	// the package database didn't change since the baseline
+	subject, err := cli.GeneratePackageManifest(
+		WithBaseline(baseline, time.Now().Add(time.Hour)),
+		WithManifestStats(&stats),
+	)
+	assert.Nil(t, err)
+	assert.Equal(t, baseline, subject)
+	// the caller's baseline must not be returned
+	assert.NotSame(t, baseline, subject)
+	assert.True(t, stats.Unchanged)
+	assert.Equal(t, manager, stats.PackageManager)
+	assert.Equal(t, 1, stats.TotalPackages)
+	assert.False(t, stats.PackageDBModTime.IsZero())
+
+	// nix packages are not tracked by the package database
+	stats = PackageManifestStats{}
+	_, err = cli.GeneratePackageManifest(
+		WithBaseline(baseline, time.Now().Add(time.Hour)),
+		WithNixPackages(),
+		WithManifestStats(&stats),
+	)
+	assert.Nil(t, err)
+	assert.False(t, stats.Unchanged)
+
+	// filters apply to the baseline
+	stats = PackageManifestStats{}
+	subject, err = cli.GeneratePackageManifest(
+		WithBaseline(baseline, time.Now().Add(time.Hour)),
+		WithPackageFilter(func(pkg api.OsPkgInfo) bool { return pkg.Pkg != "sudo" }),
+		WithManifestStats(&stats),
+	)
+	assert.Nil(t, err)
+	assert.True(t, stats.Unchanged)
+	assert.Empty(t, subject.OsPkgInfoList)
+	assert.Equal(t, 1, stats.FilteredPackages)
+	assert.Equal(t, 0, stats.TotalPackages)
+}
+
+func TestGeneratePackageManifestWithBaselineSuppressesInactiveKernels(t *testing.T) {
+	if _, err := cli.GetOSInfo(); err != nil {
+		t.Skip("unsupported platform")
+	}
+	manager, err := cli.DetectPackageManager()
+	if err != nil || manager != "dpkg-query" {
+		t.Skip("test requires dpkg")
+	}
+	if _, detected := cli.detectActiveKernel(context.Background()); !detected {
+		t.Skip("unable to detect active kernel")
+	}
+
+	// the baseline was generated before rebooting into a different kernel
+	baseline := &api.PackageManifest{
+		OsPkgInfoList: []api.OsPkgInfo{
+			api.OsPkgInfo{Os: "ubuntu", OsVer: "18.04", Pkg: "sudo", PkgVer: "1.8.21p2-3ubuntu1.2"},
+			api.OsPkgInfo{Os: "ubuntu", OsVer: "18.04", Pkg: "linux-image-0.0.1-1-fake", PkgVer: "0.0.1-1.1"},
+		},
+	}
+	subject, err := cli.GeneratePackageManifest(WithBaseline(baseline, time.Now().Add(time.Hour)))
+	assert.Nil(t, err)
+	if assert.Len(t, subject.OsPkgInfoList, 1) {
+		assert.Equal(t, "sudo", subject.OsPkgInfoList[0].Pkg)
+	}
+	assert.Len(t, baseline.OsPkgInfoList, 2)
+
+	// inventories could keep all the kernel packages
+	subject, err = cli.GeneratePackageManifest(
+		WithBaseline(baseline, time.Now().Add(time.Hour)),
+		WithoutKernelSuppression(),
+	)
+	assert.Nil(t, err)
+	assert.Equal(t, baseline.OsPkgInfoList, subject.OsPkgInfoList)
+}
+
+func TestGeneratePackageManifestWithPackageFilter(t *testing.T) {
+	if _, err := cli.GetOSInfo(); err != nil {
+		t.Skip("unsupported platform")
+	}
+	if _, err := cli.DetectPackageManager(); err != nil {
+		t.Skip("unsupported package manager")
+	}
+
+	manifest, err := cli.GeneratePackageManifest()
+	assert.Nil(t, err)
+	if len(manifest.OsPkgInfoList) == 0 {
+		t.Skip("no packages installed")
+	}
+
+	var (
+		stats    PackageManifestStats
+		included = manifest.OsPkgInfoList[0].Pkg
+	)
+	subject, err := cli.GeneratePackageManifest(
+		WithPackageFilter(func(pkg api.OsPkgInfo) bool {
+			return pkg.Pkg == included
+		}),
+		WithManifestStats(&stats),
+	)
+	assert.Nil(t, err)
+	for _, pkg := range subject.OsPkgInfoList {
+		assert.Equal(t, included, pkg.Pkg)
+	}
+	assert.NotZero(t, stats.FilteredPackages)
+	assert.Equal(t, len(subject.OsPkgInfoList), stats.TotalPackages)
+}
+
+func TestGeneratePackageManifestPhaseDurations(t *testing.T) {
+	if _, err := cli.GetOSInfo(); err != nil {
+		t.Skip("unsupported platform")
+	}
+	if _, err := cli.DetectPackageManager(); err != nil {
+		t.Skip("unsupported package manager")
+	}
+
+	var stats PackageManifestStats
+	_, err := cli.GeneratePackageManifest(WithManifestStats(&stats))
+	assert.Nil(t, err)
+	assert.NotZero(t, stats.DetectionDuration)
+	assert.NotZero(t, stats.QueryDuration)
+	assert.NotZero(t, stats.ParseDuration)
+	assert.NotZero(t, stats.SuppressionDuration)
+}
+
+func TestParseOsRelease(t *testing.T) {
+	file, err := ioutil.TempFile("", "os-release")
+	assert.Nil(t, err)
+	_, err = file.WriteString(mockUbuntuOSReleaseFile)
+	assert.Nil(t, err)
 
 	defer os.Remove(file.Name())
 
-	os, err := openOsReleaseFile(file.Name())
+	os, _, err := openOsReleaseFile(file.Name())
 	assert.Nil(t, err)
 	assert.Equal(t, mockUbuntu.Name, os.Name)
 	assert.Equal(t, mockUbuntu.Version, os.Version)
 }
 
+func TestGetOSInfoFromEnvironmentVariable(t *testing.T) {
+	file, err := ioutil.TempFile("", "os-release")
+	assert.Nil(t, err)
+	_, err = file.WriteString(mockFlatcarOSReleaseFile)
+	assert.Nil(t, err)
+
+	defer os.Remove(file.Name())
+
+	os.Setenv(OSReleasePathEnv, file.Name())
+	defer os.Setenv(OSReleasePathEnv, "")
+
+	subject, err := cli.GetOSInfo()
+	assert.Nil(t, err)
+	assert.Equal(t, "flatcar", subject.Name)
+	assert.Equal(t, "2905.2.3", subject.Version)
+	assert.NotEmpty(t, subject.Arch)
+
+	// the variable is ignored when generating the manifest for a process
+	root, err := ioutil.TempDir("", "rootfs")
+	assert.Nil(t, err)
+	defer os.RemoveAll(root)
+	assert.Nil(t, os.MkdirAll(filepath.Join(root, "etc"), 0755))
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(root, osReleaseFile), []byte(mockUbuntuOSReleaseFile), 0644))
+	subject, err = cli.getOSInfo(&packageManifestConfig{root: root})
+	if assert.Nil(t, err) {
+		assert.Equal(t, mockUbuntu.Name, subject.Name)
+		assert.Equal(t, mockUbuntu.Version, subject.Version)
+	}
+
+	os.Setenv(OSReleasePathEnv, "/path/to/a/missing/os-release")
+	_, err = cli.GetOSInfo()
+	assert.NotNil(t, err)
+}
+
+func TestOSString(t *testing.T) {
+	assert.Equal(t, "ubuntu 22.04 (x86_64)", OS{Name: "ubuntu", Version: "22.04", Arch: "x86_64"}.String())
+	assert.Equal(t, "ubuntu 22.04", OS{Name: "ubuntu", Version: "22.04"}.String())
+	assert.Equal(t, "arch (aarch64)", OS{Name: "arch", Arch: "aarch64"}.String())
+	assert.Equal(t, "ubuntu 22.04 (x86_64)",
+		fmt.Sprintf("%v", &OS{Name: "ubuntu", Version: "22.04", Arch: "x86_64"}))
+}
+
+func TestOSJSON(t *testing.T) {
+	osInfo := OS{Name: "ubuntu", Version: "22.04", Arch: "x86_64"}
+	subject, err := json.Marshal(osInfo)
+	assert.Nil(t, err)
+	assert.Equal(t, `{"name":"ubuntu","version":"22.04","arch":"x86_64"}`, string(subject))
+
+	var decoded OS
+	assert.Nil(t, json.Unmarshal(subject, &decoded))
+	assert.Equal(t, osInfo, decoded)
+
+	subject, err = json.Marshal(OS{Name: "ubuntu", Version: "22.04"})
+	assert.Nil(t, err)
+	assert.Equal(t, `{"name":"ubuntu","version":"22.04"}`, string(subject))
+
+	subject, err = json.Marshal(OS{Name: "alpine", Version: "3.18.4", InitSystem: "openrc"})
+	assert.Nil(t, err)
+	assert.Equal(t, `{"name":"alpine","version":"3.18.4","init_system":"openrc"}`, string(subject))
+}
+
+func TestGetOSInfoFromVendorOSRelease(t *testing.T) {
+	if os.Getenv(OSReleasePathEnv) != "" {
+		t.Skip("os release file overridden via environment variable")
+	}
+
+	root, err := ioutil.TempDir("", "rootfs")
+	assert.Nil(t, err)
+	defer os.RemoveAll(root)
+
+	// only the vendor file is present
+	assert.Nil(t, os.MkdirAll(filepath.Join(root, "usr", "lib"), 0755))
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(root, vendorOSReleaseFile), []byte(mockUbuntuOSReleaseFile), 0644))
+	subject, err := cli.getOSInfo(&packageManifestConfig{root: root})
+	if assert.Nil(t, err) {
+		assert.Equal(t, mockUbuntu.Name, subject.Name)
+		assert.Equal(t, mockUbuntu.Version, subject.Version)
+	}
+
+	// an absolute symlink is resolved inside the root filesystem
+	assert.Nil(t, os.MkdirAll(filepath.Join(root, "etc"), 0755))
+	assert.Nil(t, os.Symlink(vendorOSReleaseFile, filepath.Join(root, osReleaseFile)))
+	assert.Equal(t, filepath.Join(root, vendorOSReleaseFile),
+		(&packageManifestConfig{root: root}).resolvePath(osReleaseFile))
+	subject, err = cli.getOSInfo(&packageManifestConfig{root: root})
+	if assert.Nil(t, err) {
+		assert.Equal(t, mockUbuntu.Name, subject.Name)
+		assert.Equal(t, mockUbuntu.Version, subject.Version)
+	}
+
+	// the public API reads the root filesystem of the option too
+	subject, err = cli.GetOSInfo(WithRootFilesystem(root))
+	if assert.Nil(t, err) {
+		assert.Equal(t, mockUbuntu.Name, subject.Name)
+		assert.Equal(t, mockUbuntu.Version, subject.Version)
+	}
+}
+
+func TestDetectInitSystem(t *testing.T) {
+	cases := []struct {
+		expected string
+		files    []string
+	}{
+		{"systemd", []string{"/run/systemd/system/", "/etc/inittab"}},
+		{"openrc", []string{"/sbin/openrc", "/etc/inittab"}},
+		{"openrc", []string{"/run/openrc/"}},
+		{"sysvinit", []string{"/etc/inittab"}},
+		{"", nil},
+	}
+	for _, kase := range cases {
+		root, err := ioutil.TempDir("", "root")
+		assert.Nil(t, err)
+		defer os.RemoveAll(root)
+
+		for _, file := range kase.files {
+			path := filepath.Join(root, file)
+			if strings.HasSuffix(file, "/") {
+				assert.Nil(t, os.MkdirAll(path, 0755))
+				continue
+			}
+			assert.Nil(t, os.MkdirAll(filepath.Dir(path), 0755))
+			assert.Nil(t, ioutil.WriteFile(path, []byte{}, 0644))
+		}
+
+		assert.Equal(t, kase.expected,
+			cli.detectInitSystem(&packageManifestConfig{root: root}), kase.files)
+	}
+}
+
+func TestOSMapper(t *testing.T) {
+	mapper := NewOSMapper()
+	assert.Equal(t, OS{Name: "amzn", Version: "2"}, mapper.Map(OS{Name: "amazon", Version: "2"}))
+	assert.Equal(t, OS{Name: "opensuse", Version: "15.3"},
+		mapper.Map(OS{Name: "opensuse-leap", Version: "15.3"}))
+	assert.Equal(t, mockUbuntu, mapper.Map(mockUbuntu), "unmapped os should not change")
+
+	// extend and override the default mappings
+	mapper.Set("mydistro", func(osInfo OS) OS {
+		return OS{Name: "ubuntu", Version: strings.TrimPrefix(osInfo.Version, "v")}
+	}).Set("amazon", nil)
+	assert.Equal(t, OS{Name: "ubuntu", Version: "20.04"}, mapper.Map(OS{Name: "mydistro", Version: "v20.04"}))
+	assert.Equal(t, OS{Name: "amazon", Version: "2"}, mapper.Map(OS{Name: "amazon", Version: "2"}))
+
+	// the default mappings are not modified
+	assert.Equal(t, OS{Name: "amzn", Version: "2"}, NewOSMapper().Map(OS{Name: "amazon", Version: "2"}))
+}
+
+func TestGetOSInfoWithOSMapper(t *testing.T) {
+	file, err := ioutil.TempFile("", "os-release")
+	assert.Nil(t, err)
+	defer os.Remove(file.Name())
+	_, err = file.WriteString("ID=opensuse-leap\nVERSION_ID=\"15.3\"\n")
+	assert.Nil(t, err)
+
+	os.Setenv(OSReleasePathEnv, file.Name())
+	defer os.Setenv(OSReleasePathEnv, "")
+
+	subject, err := cli.GetOSInfo()
+	if assert.Nil(t, err) {
+		assert.Equal(t, "opensuse", subject.Name)
+		assert.Equal(t, "15.3", subject.Version)
+	}
+
+	subject, err = cli.GetOSInfo(WithOSMapper(NewOSMapper().Set("opensuse-leap", RenameOS("sles"))))
+	if assert.Nil(t, err) {
+		assert.Equal(t, "sles", subject.Name)
+		assert.Equal(t, "15.3", subject.Version)
+	}
+}
+
+func TestGetOSInfoRollingRelease(t *testing.T) {
+	cases := []struct {
+		osRelease string
+		expected  OS
+	}{
+		{"NAME=\"Arch Linux\"\nID=arch\nBUILD_ID=rolling\n", OS{Name: "arch", Version: RollingReleaseVersion}},
+		{"NAME=\"Gentoo\"\nID=gentoo\nVERSION_ID=\"2.14\"\n", OS{Name: "gentoo", Version: RollingReleaseVersion}},
+		{"NAME=\"openSUSE Tumbleweed\"\nID=\"opensuse-tumbleweed\"\nVERSION_ID=\"20231010\"\n",
+			OS{Name: "opensuse", Version: RollingReleaseVersion}},
+		// distros that are not rolling keep a missing version as is
+		{"NAME=\"Debian GNU/Linux\"\nID=debian\n", OS{Name: "debian"}},
+	}
+
+	file, err := ioutil.TempFile("", "os-release")
+	assert.Nil(t, err)
+	defer os.Remove(file.Name())
+	os.Setenv(OSReleasePathEnv, file.Name())
+	defer os.Setenv(OSReleasePathEnv, "")
+
+	for _, kase := range cases {
+		assert.Nil(t, ioutil.WriteFile(file.Name(), []byte(kase.osRelease), 0644))
+		subject, err := cli.GetOSInfo()
+		if assert.Nil(t, err, kase.osRelease) {
+			assert.Equal(t, kase.expected.Name, subject.Name)
+			assert.Equal(t, kase.expected.Version, subject.Version)
+		}
+	}
+}
+
+func TestToAssessmentFormat(t *testing.T) {
+	cases := []struct {
+		family   string
+		osInfo   OS
+		pkg      api.OsPkgInfo
+		expected AssessmentPackage
+	}{
+		{"debian", OS{Name: "ubuntu", Version: "22.04", Arch: "x86_64"},
+			api.OsPkgInfo{Pkg: "openssl", PkgVer: "3.0.2-0ubuntu1.10"},
+			AssessmentPackage{Os: "ubuntu", OsVer: "22.04", Pkg: "openssl", PkgVer: "3.0.2-0ubuntu1.10"}},
+		{"debian", OS{Name: "debian", Version: "12"},
+			api.OsPkgInfo{Pkg: "tzdata", PkgVer: "1:2023c-5"},
+			AssessmentPackage{Os: "debian", OsVer: "12", Pkg: "tzdata", PkgVer: "1:2023c-5"}},
+		{"rhel", OS{Name: "amzn", Version: "2"},
+			api.OsPkgInfo{Pkg: "kernel", PkgVer: "0:4.14.209-160.339.amzn2"},
+			AssessmentPackage{Os: "amzn", OsVer: "2", Pkg: "kernel", PkgVer: "0:4.14.209-160.339.amzn2"}},
+		{"rhel", OS{Name: "RHEL ", Version: " 8.6"},
+			api.OsPkgInfo{Pkg: " bash", PkgVer: "0:4.4.20-4.el8_6 "},
+			AssessmentPackage{Os: "rhel", OsVer: "8.6", Pkg: "bash", PkgVer: "0:4.4.20-4.el8_6"}},
+		{"suse", OS{Name: "sles", Version: "15.4"},
+			api.OsPkgInfo{Pkg: "libopenssl1_1", PkgVer: "0:1.1.1l-150400.7.28.1"},
+			AssessmentPackage{Os: "sles", OsVer: "15.4", Pkg: "libopenssl1_1", PkgVer: "0:1.1.1l-150400.7.28.1"}},
+		{"alpine", OS{Name: "alpine", Version: "3.18.4"},
+			api.OsPkgInfo{Pkg: "musl", PkgVer: "1.2.4-r2"},
+			AssessmentPackage{Os: "alpine", OsVer: "3.18.4", Pkg: "musl", PkgVer: "1.2.4-r2"}},
+		{"rolling", OS{Name: "arch", Version: RollingReleaseVersion},
+			api.OsPkgInfo{Pkg: "glibc", PkgVer: "2.38-7"},
+			AssessmentPackage{Os: "arch", OsVer: "rolling", Pkg: "glibc", PkgVer: "2.38-7"}},
+		{"nix", OS{Name: "nixos", Version: "23.05"},
+			api.OsPkgInfo{Pkg: "nix:hello", PkgVer: "2.12.1", Source: "nix"},
+			AssessmentPackage{Os: "nixos", OsVer: "23.05", Pkg: "nix:hello", PkgVer: "2.12.1", Source: "nix"}},
+		{"immutable", OS{Name: "flatcar", Version: "2905.2.3"},
+			api.OsPkgInfo{Pkg: "flatcar", PkgVer: "2905.2.3"},
+			AssessmentPackage{Os: "flatcar", OsVer: "2905.2.3", Pkg: "flatcar", PkgVer: "2905.2.3"}},
+	}
+	for _, kase := range cases {
+		assert.Equal(t, kase.expected, ToAssessmentFormat(kase.osInfo, kase.pkg), kase.family)
+	}
+}
+
+func TestGetEffectiveOS(t *testing.T) {
+	file, err := ioutil.TempFile("", "os-release")
+	assert.Nil(t, err)
+	defer os.Remove(file.Name())
+	_, err = file.WriteString("ID=opensuse-leap\nVERSION_ID=\"15.3\"\n")
+	assert.Nil(t, err)
+
+	os.Setenv(OSReleasePathEnv, file.Name())
+	defer os.Setenv(OSReleasePathEnv, "")
+
+	name, version, err := cli.GetEffectiveOS()
+	if assert.Nil(t, err) {
+		assert.Equal(t, "opensuse", name)
+		assert.Equal(t, "15.3", version)
+	}
+
+	name, version, err = cli.GetEffectiveOS(WithOSMapper(NewOSMapper().Set("opensuse-leap", RenameOS("sles"))))
+	if assert.Nil(t, err) {
+		assert.Equal(t, "sles", name)
+		assert.Equal(t, "15.3", version)
+	}
+
+	// the packages of the manifest use the effective operating system
+	if _, err := cli.DetectPackageManager(); err != nil {
+		return
+	}
+	manifest, err := cli.GeneratePackageManifest()
+	if assert.Nil(t, err) && len(manifest.OsPkgInfoList) != 0 {
+		assert.Equal(t, "opensuse", manifest.OsPkgInfoList[0].Os)
+		assert.Equal(t, "15.3", manifest.OsPkgInfoList[0].OsVer)
+	}
+}
+
+func TestMachineArch(t *testing.T) {
+	assert.Equal(t, "x86_64", machineArch("amd64"))
+	assert.Equal(t, "aarch64", machineArch("arm64"))
+	assert.Equal(t, "s390x", machineArch("s390x"))
+	// architectures without a single machine name are not mapped
+	assert.Equal(t, "386", machineArch("386"))
+	assert.Equal(t, "arm", machineArch("arm"))
+	assert.NotEmpty(t, machineArch(runtime.GOARCH))
+}
+
+func TestOpenRedhatReleaseFile(t *testing.T) {
+	cases := []struct {
+		expected OS
+		content  string
+	}{
+		{OS{Name: "centos", Version: "6"}, "CentOS release 6.10 (Final)\n"},
+		{OS{Name: "centos", Version: "7"}, "CentOS Linux release 7.9.2009 (Core)\n"},
+		{OS{Name: "rhel", Version: "6"}, "Red Hat Enterprise Linux Server release 6.10 (Santiago)\n"},
+		{OS{Name: "rhel", Version: "8"}, "Red Hat Enterprise Linux release 8.4 (Ootpa)\n"},
+		{OS{Name: "fedora", Version: "34"}, "Fedora release 34 (Thirty Four)\n"},
+		{OS{Name: "rocky", Version: "8"}, "Rocky Linux release 8.5 (Green Obsidian)\n"},
+	}
+	for _, kase := range cases {
+		file, err := ioutil.TempFile("", "redhat-release")
+		assert.Nil(t, err)
+		_, err = file.WriteString(kase.content)
+		assert.Nil(t, err)
+
+		subject, err := openRedhatReleaseFile(file.Name())
+		os.Remove(file.Name())
+		if assert.Nil(t, err, kase.content) {
+			assert.Equal(t, kase.expected, *subject, kase.content)
+		}
+	}
+}
+
+func TestOpenDebianVersionFile(t *testing.T) {
+	cases := []struct {
+		expected OS
+		content  string
+	}{
+		{OS{Name: "debian", Version: "8"}, "8.11\n"},
+		{OS{Name: "debian", Version: "10"}, "10.13\n"},
+		{OS{Name: "debian", Version: "11"}, "11.6\n"},
+	}
+	for _, kase := range cases {
+		file, err := ioutil.TempFile("", "debian_version")
+		assert.Nil(t, err)
+		_, err = file.WriteString(kase.content)
+		assert.Nil(t, err)
+
+		subject, err := openDebianVersionFile(file.Name())
+		os.Remove(file.Name())
+		if assert.Nil(t, err, kase.content) {
+			assert.Equal(t, kase.expected, *subject, kase.content)
+		}
+	}
+
+	file, err := ioutil.TempFile("", "debian_version")
+	assert.Nil(t, err)
+	defer os.Remove(file.Name())
+	_, err = file.WriteString("bookworm/sid\n")
+	assert.Nil(t, err)
+
+	_, err = openDebianVersionFile(file.Name())
+	assert.NotNil(t, err)
+}
+
+func TestGetOSReleaseFromClassicReleaseFiles(t *testing.T) {
+	root, err := ioutil.TempDir("", "rootfs")
+	assert.Nil(t, err)
+	defer os.RemoveAll(root)
+	assert.Nil(t, os.MkdirAll(filepath.Join(root, "etc"), 0755))
+
+	cfg := &packageManifestConfig{root: root}
+	_, err = cli.getOSRelease(cfg)
+	assert.NotNil(t, err)
+
+	assert.Nil(t, ioutil.WriteFile(
+		filepath.Join(root, debianVersionFile), []byte("9.13\n"), 0644))
+	subject, err := cli.getOSRelease(cfg)
+	if assert.Nil(t, err) {
+		assert.Equal(t, OS{Name: "debian", Version: "9"}, *subject)
+	}
+
+	// the redhat-release file has precedence over the debian_version file
+	assert.Nil(t, ioutil.WriteFile(
+		filepath.Join(root, redhatReleaseFile), []byte("CentOS Linux release 7.9.2009 (Core)\n"), 0644))
+	subject, err = cli.getOSRelease(cfg)
+	if assert.Nil(t, err) {
+		assert.Equal(t, OS{Name: "centos", Version: "7"}, *subject)
+	}
+
+	// RHEL 6 ships both the system-release and the redhat-release files
+	release := []byte("Red Hat Enterprise Linux Server release 6.10 (Santiago)\n")
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(root, redhatReleaseFile), release, 0644))
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(root, sysReleaseFile), release, 0644))
+	subject, err = cli.getOSRelease(cfg)
+	if assert.Nil(t, err) {
+		assert.Equal(t, OS{Name: "rhel", Version: "6"}, *subject)
+	}
+}
+
+func TestParseOsReleaseEdgeCases(t *testing.T) {
+	cases := []struct {
+		expected OS
+		content  string
+	}{
+		// CRLF line endings from files edited on Windows
+		{expected: mockUbuntu,
+			content: strings.ReplaceAll(mockUbuntuOSReleaseFile, "\n", "\r\n")},
+		// single quoted values
+		{expected: OS{Name: "centos", Version: "7"},
+			content: "NAME='CentOS Linux'\nID='centos'\nVERSION_ID='7'\n"},
+		// surrounding whitespaces and inline comments
+		{expected: OS{Name: "alpine", Version: "3.13.5"},
+			content: "ID=alpine  \nVERSION_ID=3.13.5 # patch release\n"},
+		{expected: OS{Name: "debian", Version: "11"},
+			content: "ID=\"debian\" # comment\r\nVERSION_ID=\"11\"\r\n"},
+	}
+	for i, kase := range cases {
+		t.Run(fmt.Sprintf("test case %d", i), func(t *testing.T) {
+			file, err := ioutil.TempFile("", "os-release")
+			assert.Nil(t, err)
+			_, err = file.WriteString(kase.content)
+			assert.Nil(t, err)
+
+			defer os.Remove(file.Name())
+
+			subject, _, err := openOsReleaseFile(file.Name())
+			assert.Nil(t, err)
+			assert.Equal(t, kase.expected, *subject)
+		})
+	}
+}
+
+func TestTrimOsReleaseValue(t *testing.T) {
+	assert.Equal(t, "ubuntu", trimOsReleaseValue("ubuntu"))
+	assert.Equal(t, "ubuntu", trimOsReleaseValue(`"ubuntu"`))
+	assert.Equal(t, "ubuntu", trimOsReleaseValue(`'ubuntu'`))
+	assert.Equal(t, "ubuntu", trimOsReleaseValue("ubuntu\r"))
+	assert.Equal(t, "ubuntu", trimOsReleaseValue(" \"ubuntu\"\r"))
+	assert.Equal(t, "Debian GNU/Linux", trimOsReleaseValue(`"Debian GNU/Linux"`))
+	assert.Equal(t, "ubuntu", trimOsReleaseValue(`"ubuntu`))
+	assert.Equal(t, "", trimOsReleaseValue(`""`))
+	assert.Equal(t, "", trimOsReleaseValue(""))
+}
+
+func TestParseOsReleaseWithoutID(t *testing.T) {
+	cases := []struct {
+		expected OS
+		fromName bool
+		content  string
+	}{
+		{expected: OS{Name: "debian", Version: "11"}, fromName: true,
+			content: mockDebianOSReleaseFileWithoutID},
+		{expected: OS{Name: "custom", Version: "1.0"}, fromName: true,
+			content: "NAME=Custom\nVERSION_ID=1.0\n"},
+		// the ID field always has precedence over the NAME field
+		{expected: mockUbuntu,
+			content: mockUbuntuOSReleaseFile},
+		// without ID and NAME fields, the operating system remains empty
+		{expected: OS{Version: "1.0"},
+			content: "VERSION_ID=1.0\n"},
+	}
+	for i, kase := range cases {
+		t.Run(fmt.Sprintf("test case %d", i), func(t *testing.T) {
+			file, err := ioutil.TempFile("", "os-release")
+			assert.Nil(t, err)
+			_, err = file.WriteString(kase.content)
+			assert.Nil(t, err)
+
+			defer os.Remove(file.Name())
+
+			subject, fromName, err := openOsReleaseFile(file.Name())
+			assert.Nil(t, err)
+			assert.Equal(t, kase.expected, *subject)
+			assert.Equal(t, kase.fromName, fromName)
+		})
+	}
+}
+
+func TestIsImmutableOS(t *testing.T) {
+	file, err := ioutil.TempFile("", "os-release")
+	assert.Nil(t, err)
+	_, err = file.WriteString(mockFlatcarOSReleaseFile)
+	assert.Nil(t, err)
+
+	defer os.Remove(file.Name())
+
+	flatcar, _, err := openOsReleaseFile(file.Name())
+	assert.Nil(t, err)
+	assert.Equal(t, OS{Name: "flatcar", Version: "2905.2.3"}, *flatcar)
+	assert.True(t, isImmutableOS(flatcar))
+	assert.True(t, isImmutableOS(&OS{Name: "coreos", Version: "2512.3.0"}))
+	assert.False(t, isImmutableOS(&mockUbuntu))
+	assert.False(t, isImmutableOS(&OS{}))
+}
+
+func TestIsEndOfLifeOS(t *testing.T) {
+	cases := []struct {
+		expected bool
+		os       OS
+	}{
+		{true, mockCentos},
+		{true, OS{Name: "centos", Version: "6"}},
+		{false, OS{Name: "centos", Version: "7"}},
+		{true, OS{Name: "ubuntu", Version: "14.04"}},
+		{false, mockUbuntu},
+		{true, OS{Name: "ubuntu", Version: "14.04.1"}},
+		{false, OS{Name: "alpine", Version: "3.100"}},
+		{true, OS{Name: "alpine", Version: "3.10.9"}},
+		{false, OS{Name: "unknown", Version: "1"}},
+		{false, OS{}},
+	}
+	for i, kase := range cases {
+		t.Run(fmt.Sprintf("test case %d", i), func(t *testing.T) {
+			assert.Equal(t, kase.expected, isEndOfLifeOS(&kase.os))
+		})
+	}
+}
+
 func TestParseSysRelease(t *testing.T) {
 	file, err := ioutil.TempFile("", "system-release")
 	assert.Nil(t, err)
@@ -269,5 +2166,124 @@ BUG_REPORT_URL="https://bugs.launchpad.net/ubuntu/"
 PRIVACY_POLICY_URL="https://www.ubuntu.com/legal/terms-and-policies/privacy-policy"
 VERSION_CODENAME=bionic
 UBUNTU_CODENAME=bionic
+`
+	mockXbpsQueryOutput = `ii bash-5.1.008_1                      GNU Bourne Again Shell
+ii xbps-triggers-0.119_1               XBPS triggers for Void Linux
+uu base-files-0.142_10                 Void Linux base system files
+ii python3-setuptools-57.4.0_1         Easily build and distribute Python packages
+ii libgcc-10.2.1pre1_3                 GCC support shared library
+`
+	mockFlatcarOSReleaseFile = `NAME="Flatcar Container Linux by Kinvolk"
+ID=flatcar
+ID_LIKE=coreos
+VERSION=2905.2.3
+VERSION_ID=2905.2.3
+BUILD_ID=2021-08-24-1844
+PRETTY_NAME="Flatcar Container Linux by Kinvolk 2905.2.3 (Oklo)"
+ANSI_COLOR="38;5;75"
+HOME_URL="https://flatcar-linux.org/"
+`
+	mockYumListInstalledOutput = `Loaded plugins: fastestmirror, security
+Installed Packages
+bash.x86_64                              4.1.2-48.el6                @base
+java-1.8.0-openjdk-headless.x86_64
+                                         1:1.8.0.275.b01-0.el6_10    @updates
+gpg-pubkey.(none)                        c105b9de-4e0fd3a3           installed
+tzdata.noarch                            2020a-1.el6                 @updates
+`
+	mockPacmanQueryOutput = `bash 5.1.016-1
+glibc 2.38-7
+linux 6.5.7.arch1-1
+linux-lts 6.1.58-1
+python-pip 23.2.1-1
+`
+	mockDpkgQueryStatusOutput = `sudo,1.8.31-1ubuntu1.2,amd64,ii
+vim,2:8.1.2269-1ubuntu5,amd64,hi
+nano,4.8-1ubuntu1,amd64,rc
+linux-image-5.4.0-42-generic,5.4.0-42.46,amd64,pn
+libssl1.1,1.1.1f-1ubuntu2.16,i386,ii
+libfoo,1.0-1,amd64,iFR
+libbar,2.0-1,amd64,iU
+libc6:amd64,2.31-0ubuntu9.9,amd64,ii
+libc6:i386,2.31-0ubuntu9.9,i386,ii
+libgcc-s1:i386,10.3.0-1ubuntu1~20.04,,ii
+`
+	mockDpkgStatusFile = `Package: sudo
+Status: install ok installed
+Priority: optional
+Architecture: amd64
+Version: 1.8.31-1ubuntu1.2
+Description: Provide limited super user privileges to specific users
+ Sudo is a program designed to allow a sysadmin to give limited root
+ privileges to users and log root activity.
+
+Package: nano
+Status: deinstall ok config-files
+Architecture: amd64
+Version: 4.8-1ubuntu1
+Conffiles:
+ /etc/nanorc 0c0d83b3b7e7a3b5f3c5a3e8b6c2a1d4
+
+Package: vim
+Status: hold ok installed
+Architecture: amd64
+Version: 2:8.1.2269-1ubuntu5
+
+Package: libc6:i386
+Status: install ok installed
+Architecture: i386
+Multi-Arch: same
+Version: 2.31-0ubuntu9.9
+`
+	mockApkInfoVersionAlpine315Output = `alpine-baselayout-3.2.0-r18
+alpine-keys-2.4-r1
+apk-tools-2.12.7-r3
+busybox-1.34.1-r3
+ca-certificates-bundle-20211220-r0
+libc-utils-0.7.2-r3
+libcrypto1.1-1.1.1l-r7
+libssl1.1-1.1.1l-r7
+libretls-3.3.4-r2
+musl-1.2.2-r7
+musl-utils-1.2.2-r7
+scanelf-1.3.3-r0
+ssl_client-1.34.1-r3
+zlib-1.2.11-r3
+py3-3to2-1.1.1-r9
+lib-2fa-1.0-r0
+`
+	mockApkInfoVersionOutput = `musl-1.2.2-r7
+busybox-1.34.1-r3
+py3-foo-0.1.0_git20220101-r0
+go-task-3.12.1_pre20220405-r1
+libfoo-dev-2.0.0_alpha1_p3-r10
+nodejs-current-18.0.0-r0-abc123
+`
+	mockOpkgListInstalledOutput = `base-files - 1423-r16886-ef8a9c5e6d
+busybox - 1.33.1-4
+kmod-nf-conntrack - 5.4.124-1
+libc - 1.1.24-4
+`
+	mockQlistInstalledOutput = `app-misc/ca-certificates-20230311.3.96.1:0
+dev-lang/python-3.11.8_p1:3.11
+dev-lang/python-3.12.2_p1-r1:3.12
+media-libs/libsdl2-2.28.5:0
+sys-apps/util-linux-2.39.3-r7:0
+sys-kernel/gentoo-kernel-bin-6.6.21:6.6.21
+sys-libs/ncurses-6.4_p20230401-r1:0/6
+x11-libs/gtk+-3.24.41-r1:3
+`
+	mockNixStoreRequisitesOutput = `/nix/store/0c4j8wfmx8rvfpyz5lbkkg7l7p8rcfnm-openssl-1.1.1k
+/nix/store/1jyjd0dm5l4j8rcbd5jhdg1w4wdqzy6x-etc
+/nix/store/2wbz9ld7vbbj7wm5jjjbq6yfvkkp6xrn-bash-4.4-p23
+/nix/store/5ynv6zjdsbqn8ygb2xmnmzgq1lzb9rjc-openssl-1.1.1k
+/nix/store/9ahkjlkc7gk3m6h2b3j6ravf3ra0mqhk-python3.9-requests-2.25.1
+`
+	mockDebianOSReleaseFileWithoutID = `PRETTY_NAME="Debian GNU/Linux 11 (bullseye)"
+NAME="Debian GNU/Linux"
+VERSION_ID="11"
+VERSION="11 (bullseye)"
+VERSION_CODENAME=bullseye
+HOME_URL="https://www.debian.org/"
 `
 )
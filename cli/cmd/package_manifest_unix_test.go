@@ -0,0 +1,73 @@
+// +build !windows
+//
+// Author:: Salim Afiune Maya (<afiune@lacework.net>)
+// Copyright:: Copyright 2021, Lacework Inc.
+// License:: Apache License, Version 2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPackageManifestQueryCancelKillsProcessGroup(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	runner := &mockPackageManagerRunner{runner: processGroupRunner{}}
+	cfg := &packageManifestConfig{runner: runner}
+	WithContext(ctx).apply(cfg)
+
+	// stand-in for a long running package manager that spawns a child process
+	start := time.Now()
+	out, err := cfg.query(exec.Command("sh", "-c", "sleep 30 & echo $!; wait"))
+	if assert.NotNil(t, err) {
+		assert.Contains(t, err.Error(), "package manager query cancelled (cmd: sh -c")
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+	}
+	assert.Less(t, time.Since(start), 10*time.Second)
+	assert.Equal(t, ctx, runner.ctx, "the context must be passed to the runner")
+
+	childPID, err := strconv.Atoi(strings.TrimSpace(string(out)))
+	if assert.Nil(t, err) {
+		assert.Eventually(t, func() bool {
+			return syscall.Kill(childPID, 0) == syscall.ESRCH
+		}, 5*time.Second, 50*time.Millisecond, "the child process must be terminated")
+	}
+}
+
+func TestPackageManifestQueryWithoutCancel(t *testing.T) {
+	runner := &mockPackageManagerRunner{runner: processGroupRunner{}}
+	cfg := &packageManifestConfig{runner: runner}
+	WithContext(context.Background()).apply(cfg)
+
+	out, err := cfg.query(exec.Command("sh", "-c", "echo pkg,1.0"))
+	assert.Nil(t, err)
+	assert.Equal(t, "pkg,1.0\n", string(out))
+
+	_, err = cfg.query(exec.Command("sh", "-c", "echo 'rpmdb: BDB0113 Thread died' >&2; exit 1"))
+	if assert.NotNil(t, err) {
+		assert.Contains(t, err.Error(), "rpmdb: BDB0113 Thread died")
+	}
+	assert.Len(t, runner.commands, 2)
+}
@@ -0,0 +1,127 @@
+//
+// Author:: Salim Afiune Maya (<afiune@lacework.net>)
+// Copyright:: Copyright 2021, Lacework Inc.
+// License:: Apache License, Version 2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package cmd
+
+import (
+	"os/exec"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// FileIntegrityIssue is a file of an installed package that doesn't match the
+// information from the database of the package manager
+type FileIntegrityIssue struct {
+	Path string
+
+	// the file is marked as a configuration file, changes are usually expected
+	ConfigFile bool
+
+	// the file doesn't exist
+	Missing bool
+
+	// the attributes of the file that changed, like size, mode or digest
+	Changes []string
+}
+
+var (
+	// matches every line from the output of 'rpm -V' and 'dpkg --verify'
+	//
+	// Example of a line from the output:
+	//
+	// S.5....T.  c /etc/sudoers
+	rexVerifyLine = regexp.MustCompile(`^([.?SM5DLUGTP]{8,9}|missing)\s+(?:([cdglr])\s+)?(/.*)$`)
+
+	// the attribute that every position of the verify flags represents
+	verifyAttributes = []string{
+		"size", "mode", "digest", "device", "link", "user", "group", "mtime", "capabilities",
+	}
+)
+
+// VerifyPackage runs the verify command of the package manager of the host for
+// the provided package and returns the files that were modified since they were
+// installed, this is independent of the generation of package manifests
+func (c *cliState) VerifyPackage(name string) ([]FileIntegrityIssue, error) {
+	if name == "" {
+		return nil, errors.New("package name must be provided")
+	}
+
+	// knowing the OS selects the package manager of the distro on mixed systems
+	cfg := new(packageManifestConfig)
+	if osInfo, err := c.getOSInfo(cfg); err == nil {
+		cfg.osInfo = osInfo
+	}
+
+	manager, err := c.detectPackageManager(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	var query []byte
+	switch manager {
+	case "rpm":
+		query, err = cfg.query(cfg.command("rpm", "-V", name))
+	case "dpkg-query":
+		query, err = cfg.query(cfg.command("dpkg", "--verify", name))
+	default:
+		return nil, errors.Errorf("verifying packages is not supported for '%s'", manager)
+	}
+
+	c.Log.Debugw("package verify query", "package", name, "raw", string(query))
+
+	// verify commands exit with a non-zero status when files were modified
+	var exitError *exec.ExitError
+	if err != nil && !(errors.As(err, &exitError) && len(query) != 0) {
+		return nil, err
+	}
+
+	issues, err := parseVerifyQuery(query)
+	return issues, errors.Wrapf(err, "unable to verify package '%s'", name)
+}
+
+// parseVerifyQuery parses the output of the commands 'rpm -V' and 'dpkg --verify'
+// into a list of issues, lines from the output that are not about files are ignored
+func parseVerifyQuery(query []byte) ([]FileIntegrityIssue, error) {
+	issues := []FileIntegrityIssue{}
+	for _, line := range strings.Split(string(query), "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasSuffix(line, "is not installed") {
+			return nil, errors.New(line)
+		}
+
+		m := rexVerifyLine.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+
+		issue := FileIntegrityIssue{Path: m[3], ConfigFile: m[2] == "c", Changes: []string{}}
+		if m[1] == "missing" {
+			issue.Missing = true
+		} else {
+			for i, flag := range m[1] {
+				if flag != '.' && flag != '?' {
+					issue.Changes = append(issue.Changes, verifyAttributes[i])
+				}
+			}
+		}
+		issues = append(issues, issue)
+	}
+	return issues, nil
+}
@@ -0,0 +1,66 @@
+//
+// Author:: Salim Afiune Maya (<afiune@lacework.net>)
+// Copyright:: Copyright 2021, Lacework Inc.
+// License:: Apache License, Version 2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+
+package cmd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseVerifyQueryRpm(t *testing.T) {
+	subject, err := parseVerifyQuery([]byte(`S.5....T.  c /etc/sudoers
+.M.......    /usr/bin/sudo
+missing   d /usr/share/doc/sudo/README
+Unsatisfied dependencies for sudo-1.8.23-10.el7.x86_64:
+`))
+	assert.Nil(t, err)
+	assert.Equal(t, []FileIntegrityIssue{
+		{Path: "/etc/sudoers", ConfigFile: true, Changes: []string{"size", "digest", "mtime"}},
+		{Path: "/usr/bin/sudo", Changes: []string{"mode"}},
+		{Path: "/usr/share/doc/sudo/README", Missing: true, Changes: []string{}},
+	}, subject)
+
+	_, err = parseVerifyQuery([]byte("package foo is not installed\n"))
+	if assert.NotNil(t, err) {
+		assert.Equal(t, "package foo is not installed", err.Error())
+	}
+}
+
+func TestParseVerifyQueryDpkg(t *testing.T) {
+	subject, err := parseVerifyQuery([]byte(`??5?????? c /etc/sudoers
+??5??????   /usr/bin/sudo
+`))
+	assert.Nil(t, err)
+	assert.Equal(t, []FileIntegrityIssue{
+		{Path: "/etc/sudoers", ConfigFile: true, Changes: []string{"digest"}},
+		{Path: "/usr/bin/sudo", Changes: []string{"digest"}},
+	}, subject)
+
+	subject, err = parseVerifyQuery([]byte(""))
+	assert.Nil(t, err)
+	assert.Empty(t, subject)
+}
+
+func TestVerifyPackageEmptyName(t *testing.T) {
+	_, err := cli.VerifyPackage("")
+	if assert.NotNil(t, err) {
+		assert.Equal(t, "package name must be provided", err.Error())
+	}
+}